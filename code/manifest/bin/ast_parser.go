@@ -1,474 +1,339 @@
 // code/manifest/bin/ast_parser.go
+// Commande ast_parser: interface en ligne de commande de la bibliothèque astparser.
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"crypto/sha1"
-	"encoding/hex"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"go/ast"
-	"go/format"
-	"go/parser"
-	"go/token"
-	"io/ioutil"
+	"go/build"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
-	"unicode"
-	// "encoding/base64" // Retiré car sanitizeIdentifier n'utilise plus base64
-)
-
-// FragmentManifest est la structure racine du JSON de sortie.
-type FragmentManifest struct {
-	Fragments map[string]FragmentInfo `json:"fragments"`
-}
-
-// ImportInfo contient les détails d'une déclaration d'import.
-type ImportInfo struct {
-	Name string `json:"name,omitempty"` // Alias (ex: v pour viper)
-	Path string `json:"path"`           // Chemin d'import (ex: "github.com/spf13/viper")
-}
-
-// FragmentInfo contient les métadonnées d'un fragment de code.
-type FragmentInfo struct {
-	OriginalPath     string       `json:"original_path"`      // Chemin du fichier .go (ex: main.go, admin_templ.go)
-	ActualSourcePath string       `json:"actual_source_path"` // Chemin du .templ si applicable, sinon OriginalPath
-	IsTemplSource    bool         `json:"is_templ_source"`    // True si ActualSourcePath est un .templ
-	PackageName      string       `json:"package_name"`
-	FragmentType     string       `json:"fragment_type"`           // "function", "method", "type", "constant", "variable"
-	Identifier       string       `json:"identifier"`              // Nom func/methode/type/const/var
-	ReceiverType     string       `json:"receiver_type,omitempty"` // Pour méthodes
-	Signature        string       `json:"signature,omitempty"`     // Pour funcs/methods
-	Definition       string       `json:"definition,omitempty"`    // Pour types, consts, vars
-	Docstring        string       `json:"docstring,omitempty"`     // Docstring extrait de l'AST du .go
-	StartLine        int          `json:"start_line"`              // Ligne de début dans OriginalPath
-	EndLine          int          `json:"end_line"`                // Ligne de fin dans OriginalPath
-	Imports          []ImportInfo `json:"imports,omitempty"`       // Imports du fichier OriginalPath
-	CodeDigest       string       `json:"code_digest,omitempty"`   // SHA-1 du noeud formaté du fragment dans OriginalPath
-	// Les champs suivants sont initialisés mais non remplis par ce parseur basique.
-	// Ils pourraient être utilisés par des analyses plus poussées.
-	DirectCallsInternal []string `json:"direct_calls_internal,omitempty"`
-	TypesUsedInternal   []string `json:"types_used_internal,omitempty"`
-}
 
-// visitor pour parcourir l'AST
-type visitor struct {
-	fset                       *token.FileSet
-	fragments                  map[string]FragmentInfo
-	currentOriginalPathRel     string // Chemin relatif du fichier .go en cours d'analyse
-	currentActualSourcePathRel string // Chemin relatif du .templ source si applicable
-	currentIsTemplSource       bool   // True si on traite le source .templ
-	currentPackageName         string
-	currentFileImports         []ImportInfo
-	projectRootDirAbs          string // Racine absolue du projet pour résoudre les chemins .templ
-}
+	"github.com/remi-viau/Code-Expert/code/manifest/bin/astparser"
+)
 
 // --- Main Function ---
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <directory_path>\n", os.Args[0])
-		os.Exit(1)
-	}
-	rootDir := os.Args[1]
-	absRootDir, err := filepath.Abs(rootDir)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "[AST Parser] Erreur: Résolution chemin absolu pour %q échouée: %v\n", rootDir, err)
-		os.Exit(1)
-	}
-
-	manifest := FragmentManifest{Fragments: make(map[string]FragmentInfo)}
-	fset := token.NewFileSet()
-
-	fmt.Fprintf(os.Stderr, "[AST Parser] Analyse du projet Go dans: %s\n", absRootDir)
-
-	err = filepath.Walk(absRootDir, func(path string, fileinfo os.FileInfo, walkErr error) error {
-		if walkErr != nil {
-			fmt.Fprintf(os.Stderr, "[AST Parser] Avertissement: Erreur accès à %q: %v\n", path, walkErr)
-			return nil // Tenter de continuer
-		}
-
-		if fileinfo.IsDir() {
-			dirName := fileinfo.Name()
-			// Ignorer les dossiers connus et les dossiers cachés
-			// Ajout de "webroot/static" ou "public" si ce sont des assets compilés
-			if dirName == ".git" || dirName == "vendor" || dirName == "node_modules" ||
-				dirName == "venv" || dirName == ".idea" || dirName == ".vscode" ||
-				dirName == "tmp_go_format" || dirName == "static" || dirName == "public" || // Exclure les assets statiques courants
-				strings.HasPrefix(dirName, ".") {
-				fmt.Fprintf(os.Stderr, "[AST Parser] Ignoré dossier: %s\n", path)
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		lowerPath := strings.ToLower(path)
-		// Ignorer les fichiers non-Go et les fichiers de test Go
-		if !strings.HasSuffix(lowerPath, ".go") || strings.HasSuffix(lowerPath, "_test.go") {
-			return nil
-		}
-
-		// originalGoPathRel est le chemin relatif du fichier .go traité
-		originalGoPathRel, err := filepath.Rel(absRootDir, path)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "[AST Parser] Avertissement: Échec calcul chemin relatif pour %q: %v. Utilisation chemin complet.\n", path, err)
-			originalGoPathRel = path
-		}
-		originalGoPathRel = filepath.ToSlash(originalGoPathRel)
-
-		fmt.Fprintf(os.Stderr, "[AST Parser] Parsing du fichier Go: %s\n", originalGoPathRel)
-		contentBytes, err := ioutil.ReadFile(path)
+	opts, rootDir, outputPath := parseFlags()
+	out := os.Stdout
+	if outputPath != "" {
+		file, err := createOutput(outputPath)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "[AST Parser] Avertissement: Échec lecture fichier %q: %v\n", path, err)
-			return nil
+			fmt.Fprintf(os.Stderr, "[AST Parser] Erreur -o %q: %v\n", outputPath, err)
+			os.Exit(1)
 		}
-
-		node, err := parser.ParseFile(fset, path, contentBytes, parser.ParseComments)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "[AST Parser] Avertissement: Échec parsing fichier %q: %v\n", originalGoPathRel, err)
-			return nil
-		}
-
-		// Déterminer si c'est un fichier _templ.go et trouver son source .templ
-		var actualSrcPathRel string
-		var isTemplSrc bool
-		if strings.HasSuffix(originalGoPathRel, "_templ.go") {
-			// path est le chemin absolu du fichier _templ.go
-			templSrc, found := findTemplSourcePath(path, absRootDir)
-			if found {
-				actualSrcPathRel = templSrc
-				isTemplSrc = true
-				fmt.Fprintf(os.Stderr, "[AST Parser]   -> Fichier source .templ identifié: %s\n", actualSrcPathRel)
-			} else {
-				actualSrcPathRel = originalGoPathRel // Fallback sur le _templ.go
-				isTemplSrc = false
-				fmt.Fprintf(os.Stderr, "[AST Parser]   -> Fichier source .templ non trouvé pour %s, utilisation de _templ.go lui-même.\n", originalGoPathRel)
-			}
-		} else {
-			actualSrcPathRel = originalGoPathRel
-			isTemplSrc = false
-		}
-
-		v := &visitor{
-			fset:                       fset,
-			fragments:                  manifest.Fragments,
-			currentOriginalPathRel:     originalGoPathRel, // Toujours le .go
-			currentActualSourcePathRel: actualSrcPathRel,  // Le .templ ou le .go
-			currentIsTemplSource:       isTemplSrc,
-			currentPackageName:         node.Name.Name,
-			currentFileImports:         extractImports(node),
-			projectRootDirAbs:          absRootDir,
+		out = file
+	}
+	err := astparser.Run(rootDir, opts, out)
+	if outputPath != "" {
+		if closeErr := commitOutput(out, outputPath, err); err == nil && closeErr != nil {
+			err = fmt.Errorf("-o %q: %w", outputPath, closeErr)
 		}
-
-		ast.Walk(v, node)
-		return nil
-	})
-
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "[AST Parser] Erreur fatale parcours répertoire %q: %v\n", rootDir, err)
-		os.Exit(1)
 	}
-
-	fmt.Fprintf(os.Stderr, "[AST Parser] Fin parcours. %d fragments. Marshalling JSON...\n", len(manifest.Fragments))
-	jsonData, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[AST Parser] Erreur marshalling JSON: %v\n", err)
+		// Une vérification échouée a déjà été détaillée sur stderr.
+		if !errors.Is(err, astparser.ErrChecksFailed) {
+			fmt.Fprintf(os.Stderr, "[AST Parser] Erreur: %v\n", err)
+		}
 		os.Exit(1)
 	}
-	fmt.Println(string(jsonData))
-	fmt.Fprintf(os.Stderr, "[AST Parser] Analyse terminée. Manifeste JSON généré.\n")
 }
 
-// findTemplSourcePath tente de trouver le .templ source pour un _templ.go donné.
-// goTemplFileAbsPath: chemin absolu du fichier _templ.go.
-// projectRootDirAbs: chemin absolu de la racine du projet Go.
-// Retourne: chemin relatif du .templ par rapport à projectRootDirAbs, bool indiquant si trouvé.
-func findTemplSourcePath(goTemplFileAbsPath string, projectRootDirAbs string) (string, bool) {
-	dir := filepath.Dir(goTemplFileAbsPath)
-	baseName := filepath.Base(goTemplFileAbsPath)
-
-	// 1. Essayer la convention de nommage: foo_templ.go -> foo.templ
-	if strings.HasSuffix(baseName, "_templ.go") {
-		templFileName := strings.TrimSuffix(baseName, "_templ.go") + ".templ"
-		potentialTemplPathAbs := filepath.Join(dir, templFileName)
-		if _, err := os.Stat(potentialTemplPathAbs); err == nil {
-			relPath, errRel := filepath.Rel(projectRootDirAbs, potentialTemplPathAbs)
-			if errRel == nil {
-				return filepath.ToSlash(relPath), true
-			}
-			fmt.Fprintf(os.Stderr, "[AST Parser] Avertissement: Convention .templ: erreur calcul rel path pour %s (base: %s): %v\n", potentialTemplPathAbs, projectRootDirAbs, errRel)
+// createOutput crée, à côté du fichier de -o (dossiers parents compris), le fichier temporaire
+// qui reçoit la sortie: commitOutput le renomme une fois l'analyse réussie, pour qu'un manifeste
+// existant ne soit jamais remplacé par une sortie tronquée.
+func createOutput(outputPath string) (*os.File, error) {
+	dir := filepath.Dir(outputPath)
+	if dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
 		}
 	}
-
-	// 2. Fallback sur le commentaire "// File: ..."
-	file, err := os.Open(goTemplFileAbsPath)
+	file, err := os.CreateTemp(dir, "."+filepath.Base(outputPath)+".*.tmp")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[AST Parser] Avertissement: Erreur ouverture %s pour commentaire .templ: %v\n", goTemplFileAbsPath, err)
-		return "", false
-	}
-	defer file.Close()
-
-	// Regex pour `// File: path/to/something.templ` (doit se terminer par .templ)
-	re := regexp.MustCompile(`^\s*//\s*File:\s*(.+\.templ)\s*$`)
-	scanner := bufio.NewScanner(file)
-	for i := 0; i < 20 && scanner.Scan(); i++ { // Limiter la recherche aux premières lignes
-		line := scanner.Text()
-		matches := re.FindStringSubmatch(line)
-		if len(matches) > 1 {
-			pathFromComment := strings.TrimSpace(matches[1])
-			// pathFromComment est relatif à la racine du projet où `templ generate` a été exécuté.
-			// On suppose que c'est projectRootDirAbs.
-			absPathFromComment := filepath.Join(projectRootDirAbs, pathFromComment)
-			if _, err := os.Stat(absPathFromComment); err == nil {
-				// S'assurer de retourner le chemin relatif au projet, pas celui du commentaire brut s'il est différent
-				relPath, errRel := filepath.Rel(projectRootDirAbs, absPathFromComment)
-				if errRel == nil {
-					return filepath.ToSlash(relPath), true
-				}
-				fmt.Fprintf(os.Stderr, "[AST Parser] Avertissement: Commentaire .templ: erreur calcul rel path pour %s (base: %s): %v\n", absPathFromComment, projectRootDirAbs, errRel)
-			} else {
-				fmt.Fprintf(os.Stderr, "[AST Parser] Avertissement: Commentaire .templ trouvé: '%s', mais fichier inexistant à: '%s'\n", pathFromComment, absPathFromComment)
-			}
-			return "", false // Commentaire trouvé mais fichier invalide ou erreur chemin
-		}
+		return nil, err
 	}
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "[AST Parser] Erreur lecture %s pour commentaire .templ: %v\n", goTemplFileAbsPath, err)
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
 	}
-	return "", false // Non trouvé
+	return file, nil
 }
 
-// Méthode Visit de la structure visitor
-func (v *visitor) Visit(node ast.Node) ast.Visitor {
-	if node == nil {
-		return nil
-	}
-	pos, endPos := node.Pos(), node.End()
-	if !pos.IsValid() || !endPos.IsValid() {
-		return v
+// commitOutput ferme le fichier temporaire de createOutput et le renomme en outputPath si
+// l'analyse (runErr) et la fermeture ont réussi; sinon il est supprimé. Retourne l'erreur de
+// fermeture ou de renommage.
+func commitOutput(file *os.File, outputPath string, runErr error) error {
+	err := file.Close()
+	if runErr == nil && err == nil {
+		err = os.Rename(file.Name(), outputPath)
 	}
-
-	fragmentID := ""
-	// Initialiser FragmentInfo avec les données du fichier en cours
-	info := FragmentInfo{
-		OriginalPath:        v.currentOriginalPathRel,     // Chemin du .go (ex: foo_templ.go)
-		ActualSourcePath:    v.currentActualSourcePathRel, // Chemin du .templ ou du .go
-		IsTemplSource:       v.currentIsTemplSource,
-		PackageName:         v.currentPackageName,
-		StartLine:           v.fset.Position(pos).Line,    // Lignes relatives à OriginalPath
-		EndLine:             v.fset.Position(endPos).Line, // Lignes relatives à OriginalPath
-		Imports:             v.currentFileImports,
-		DirectCallsInternal: []string{},
-		TypesUsedInternal:   []string{},
+	if runErr != nil || err != nil {
+		os.Remove(file.Name())
 	}
+	return err
+}
 
-	switch x := node.(type) {
-	case *ast.FuncDecl:
-		if x.Name == nil || x.Name.Name == "_" || x.Name.Name == "init" { // Ignorer aussi les fonctions init
-			return v
-		}
-		info.Identifier = x.Name.Name
-		info.Docstring = getDocstring(x.Doc) // Docstring de l'AST du .go
-		info.Signature = buildSignatureString(v.fset, x)
-
-		// Construire un fragmentID basé sur OriginalPath pour l'unicité des fragments du .go
-		// On utilise le nom du fichier .go sans extension pour la base de l'ID.
-		goFileNameWithoutExt := strings.TrimSuffix(filepath.Base(v.currentOriginalPathRel), ".go")
-		fragmentIDBase := fmt.Sprintf("%s_%s", v.currentPackageName, goFileNameWithoutExt)
-
-		if x.Recv != nil && len(x.Recv.List) > 0 {
-			info.FragmentType = "method"
-			info.ReceiverType = typeToString(v.fset, x.Recv.List[0].Type)
-			fragmentID = fmt.Sprintf("%s_%s_%s", fragmentIDBase, sanitizeIdentifier(info.ReceiverType), info.Identifier)
-		} else {
-			info.FragmentType = "function"
-			fragmentID = fmt.Sprintf("%s_%s", fragmentIDBase, info.Identifier)
-		}
-
-		var buf bytes.Buffer
-		if err := format.Node(&buf, v.fset, x); err == nil {
-			sum := sha1.Sum(buf.Bytes())
-			info.CodeDigest = hex.EncodeToString(sum[:])
-		} else {
-			fmt.Fprintf(os.Stderr, "[AST Parser] Erreur digest func/meth %s: %v\n", info.Identifier, err)
+// parseFlags lit les options de la ligne de commande et retourne le répertoire à analyser et
+// le fichier de sortie de -o ("" = stdout). Les valeurs par défaut sont celles de
+// astparser.DefaultOptions; astparser.Run valide les valeurs.
+func parseFlags() (astparser.Options, string, string) {
+	opts := astparser.DefaultOptions()
+	var outputPath, stdinRoot string
+	flag.BoolVar(&opts.ResolveImplementations, "resolve-implementations", false,
+		"Calcule pour chaque interface les types du projet qui l'implémentent (champ implemented_by)")
+	flag.BoolVar(&opts.RootRelativeIDs, "root-relative-ids", false,
+		"Préfixe les IDs de fragments par le répertoire du fichier relatif à la racine (IDs uniques même avec des paquets homonymes)")
+	flag.BoolVar(&opts.IDDirHash, "id-dir-hash", false,
+		"Ajoute à la base des IDs un hash court du répertoire du fichier (IDs uniques et traçables sans allonger les IDs comme -root-relative-ids)")
+	deprecatedTags := flag.String("deprecated-tags", "",
+		"Liste de build tags séparées par des virgules (ex: legacy,old); les fragments des fichiers qui les exigent sont marqués deprecated_by_tag")
+	buildTags := flag.String("build-tags", "",
+		"Liste de build tags séparées par des virgules; n'analyse que les fichiers retenus par go build avec ces tags et GOOS/GOARCH de l'environnement (//go:build, // +build, suffixes _linux.go...). -build-tags '' filtre sur GOOS/GOARCH seuls")
+	flag.BoolVar(&opts.ExportedOnly, "exported-only", false,
+		"N'émet que les fragments exportés (identifiant en majuscule; méthodes exportées de types exportés, hors export_test.go) et compte les autres sur stderr")
+	flag.BoolVar(&opts.KeepUnexportedReceivers, "keep-unexported-receivers", false,
+		"Avec -exported-only, garde aussi les méthodes exportées des types non exportés (accessibles via interfaces ou embarquement)")
+	nameFilter := flag.String("name-filter", "",
+		"N'émet que les fragments dont l'identifiant correspond à cette regex (ex: 'Handler$', '^Test')")
+	flag.BoolVar(&opts.TypeCheck, "type-check", false,
+		"Charge et vérifie les paquets (go/packages, go/types; commande go et go.mod requis) pour résoudre exactement les appels (direct_calls_internal, sinon résolus par nom); plus lent")
+	flag.BoolVar(&opts.SplitCallEdges, "split-call-edges", false,
+		"Répartit direct_calls_internal en direct_calls_same_package et direct_calls_cross_package (appels résolus par noms, ou par go/types avec -type-check)")
+	flag.BoolVar(&opts.DetectUntested, "detect-untested", false,
+		"Analyse aussi les _test.go et marque has_test les fragments qu'ils appellent; résume les fonctions exportées sans test; implique -type-check")
+	flag.BoolVar(&opts.IncludeTests, "include-tests", false,
+		"Analyse aussi les _test.go comme les autres fichiers: leurs fragments portent is_test et, pour les fonctions Test/Benchmark/Fuzz/Example, test_kind; ceux de export_test.go portent aussi is_test_export")
+	flag.BoolVar(&opts.RecordMtimes, "record-mtimes", false,
+		"Enregistre la date de modification de chaque fichier .go (file_mod_times); rend la sortie non déterministe")
+	flag.BoolVar(&opts.RecordHeaders, "record-headers", false,
+		"Enregistre le commentaire d'en-tête de chaque fichier .go, hors doc de paquet et contraintes de build (file_headers)")
+	flag.BoolVar(&opts.WithFileSymbols, "with-file-symbols", false,
+		"Ajoute à chaque fragment file_symbols: les symboles déclarés dans le même fichier (contexte local pour un LLM)")
+	flag.BoolVar(&opts.FileDigests, "file-digests", false,
+		"Ajoute file_digests: digest (-digest) brut de chaque .go et digest après normalisation gofmt (ignore les changements de formatage)")
+	flag.BoolVar(&opts.EmitFileStats, "emit-file-stats", false,
+		"Ajoute file_stats: nombre de fragments, lignes et octets par fichier .go (répartition du travail d'indexation)")
+	flag.StringVar(&opts.BatchDiff, "batch-diff", "",
+		"Lit des manifestes (un JSON par ligne, dans l'ordre des commits) et émet en NDJSON le diff de chaque paire consécutive")
+	flag.IntVar(&opts.MaxFuncLines, "max-func-lines", 0,
+		"Marque too_long les fonctions/méthodes dont EndLine - StartLine dépasse N lignes (0 = désactivé)")
+	flag.IntVar(&opts.MaxParams, "max-params", 0,
+		"Marque too_many_params les fonctions/méthodes de plus de N paramètres, receveur exclu (0 = désactivé)")
+	flag.BoolVar(&opts.GroupConstBlocks, "group-const-blocks", false,
+		"Émet un fragment const_group par bloc const (...), avec ses constantes dans members, au lieu d'un fragment par constante (énumérations)")
+	flag.BoolVar(&opts.AnonStructFields, "anon-struct-fields", false,
+		"Décrit dans fields les champs des variables de type struct anonyme (struct{...}{}, []struct{...}{...}), structs imbriquées comprises sur 3 niveaux, et dans methods celles des interfaces anonymes")
+	flag.IntVar(&opts.ChunkLines, "chunk-lines", 0,
+		"Pour les fonctions/méthodes de plus de N lignes, ajoute chunk_digests: un digest (-digest) par bloc de N lignes (0 = désactivé)")
+	flag.BoolVar(&opts.FailOnLongFunc, "fail-on-long-func", false,
+		"Avec -max-func-lines, termine avec un code non nul si une fonction est trop longue")
+	flag.BoolVar(&opts.CheckIDs, "check-ids", false,
+		"Émet, au lieu du manifeste, les IDs de fragments produits par plusieurs déclarations (écrasés dans le manifeste); code de sortie non nul s'il y en a")
+	flag.BoolVar(&opts.DetectImportCycles, "detect-import-cycles", false,
+		"Émet, au lieu du manifeste, les cycles du graphe d'imports entre paquets du projet (chemins d'import)")
+	flag.BoolVar(&opts.FailOnCycle, "fail-on-cycle", false, "Avec -detect-import-cycles: code de sortie non nul si un cycle est trouvé")
+	flag.BoolVar(&opts.FindDuplicates, "find-duplicates", false,
+		"Émet, au lieu du manifeste, les groupes de fragments partageant le même code_digest")
+	flag.BoolVar(&opts.GroupByMethodName, "group-by-method-name", false,
+		"Émet, au lieu du manifeste, les méthodes regroupées par nom (receveurs et IDs de chaque implémentation)")
+	flag.BoolVar(&opts.FuzzyDigests, "fuzzy-digests", false,
+		"Ajoute fuzzy_digest: SimHash du code aux identifiants et littéraux normalisés (code presque identique = digests proches)")
+	flag.Float64Var(&opts.FindSimilar, "find-similar", 0,
+		"Émet, au lieu du manifeste, les groupes de fragments dont la similarité de fuzzy_digest atteint ce seuil (ex: 0.9); implique -fuzzy-digests")
+	flag.BoolVar(&opts.CommentDensity, "comment-density", false,
+		"Calcule comment_lines et comment_density (lignes de commentaire / lignes totales) par fragment")
+	flag.BoolVar(&opts.LinkGenerated, "link-generated", false,
+		"Relie les fragments des fichiers générés à la directive //go:generate probable du même dossier (generated_by)")
+	flag.BoolVar(&opts.ExcludeGenerated, "skip-generated", false, "Alias de -exclude-generated")
+	flag.BoolVar(&opts.ExcludeGenerated, "exclude-generated", false,
+		"Ignore (sans les parser) les fichiers portant l'en-tête '// Code generated ... DO NOT EDIT.', _templ.go inclus")
+	flag.BoolVar(&opts.AnalyzeImports, "analyze-imports", false,
+		"Calcule les imports utilisés par chaque fragment (imports_used) et leur nombre d'usages par paquet (packages.import_usage)")
+	flag.BoolVar(&opts.ChangedPackagesOnly, "changed-packages-only", false,
+		"N'émet que les fragments des paquets dont le package_digest diffère de -baseline (delta à fusionner); implique -package-digests")
+	flag.StringVar(&opts.BaselinePath, "baseline", "", "Manifeste de référence de -changed-packages-only (généré avec -package-digests)")
+	flag.BoolVar(&opts.PackageDigests, "package-digests", false,
+		"Calcule par paquet un package_digest (hash des code_digest triés), stable tant qu'aucun fragment ne change")
+	flag.BoolVar(&opts.APIHashes, "api-hashes", false,
+		"Calcule par paquet un public_api_hash sur les signatures canoniques des fragments exportés (inchangé = API inchangée)")
+	flag.BoolVar(&opts.NormalizeReceivers, "normalize-receivers", false,
+		"receiver_type devient le nom de base du type; pointeur et paramètres de type vont dans receiver_is_pointer/receiver_type_params")
+	flag.BoolVar(&opts.DryRun, "dry-run", false,
+		"Effectue le parcours sans rien parser et émet la liste des fichiers qui seraient analysés et ignorés (avec la raison)")
+	flag.BoolVar(&opts.CanonicalSignatures, "canonical-signatures", false,
+		"Ajoute canonical_signature: type de fonction sans noms de paramètres ni receveur, types normalisés")
+	flag.BoolVar(&opts.CheckAlignment, "check-alignment", false,
+		"Calcule struct_size et field_alignment_savings (octets de padding évitables) des structs, tailles gc/amd64")
+	flag.BoolVar(&opts.ResolveConstValues, "resolve-const-values", false,
+		"Renseigne resolved_value des constantes (ex: 1 pour iota + 1) via go/types et go/constant; vérifie les types du projet comme -type-check, donc plus lent. Sans valeur si l'expression dépend d'une erreur de types ou d'un import introuvable")
+	flag.BoolVar(&opts.RenderDocs, "render-docs", false,
+		"Ajoute docstring_html: la docstring rendue en HTML par go/doc/comment (liens, listes, blocs de code, comme pkg.go.dev)")
+	flag.BoolVar(&opts.MarkInternalImports, "mark-internal-imports", false,
+		"Marque is_internal_to_module les imports situés sous le chemin du module (go.mod) contenant le fichier")
+	flag.BoolVar(&opts.FollowReplaces, "follow-replaces", false,
+		"Analyse aussi les répertoires locaux cibles des directives replace du go.mod racine (module_path sur leurs fragments)")
+	flag.StringVar(&opts.StripPrefix, "strip-prefix", "",
+		"Préfixe retiré des chemins émis (original_path, actual_source_path); un chemin absolu est pris relativement au dossier analysé")
+	flag.Float64Var(&opts.MinDocCoverage, "min-doc-coverage", 0,
+		"Termine avec un code non nul si moins de N % des fragments exportés ont une docstring (liste les non documentés)")
+	flag.StringVar(&opts.KeyBy, "key-by", opts.KeyBy,
+		"Clés du manifeste: id (pkg_fichier_nom) ou qualified (chemin/import.Type.Méthode, suffixe @chemin en cas de collision)")
+	flag.BoolVar(&opts.DetectLockLeaks, "detect-lock-leaks", false,
+		"Marque possible_lock_leak les fonctions appelant x.Lock()/x.RLock() sans x.Unlock()/x.RUnlock() (heuristique syntaxique)")
+	flag.BoolVar(&opts.InternImports, "intern-imports", false,
+		"Remplace imports par import_refs, indices dans une table import_table commune au manifeste (sortie plus compacte)")
+	flag.BoolVar(&opts.DirtyOnly, "dirty-only", false,
+		"N'analyse que les .go modifiés, ajoutés ou non suivis du dépôt git (indexés ou non), pour un hook pre-commit. Le dossier est tout de même parcouru, par noms seulement, pour que les IDs restent ceux d'une analyse complète (seul l'en-tête des fichiers homonymes est lu; pas avec -id-dir-hash ni -root-relative-ids)")
+	flag.Func("exclude-dir", "Dossier à ignorer en plus des défauts: nom (tous les dossiers de ce nom) ou chemin relatif à la racine; répétable ou séparé par des virgules", func(value string) error {
+		for _, dir := range splitDirList(value) {
+			opts.DirSkips.Excluded[dir] = "dossier exclu (-exclude-dir)"
 		}
-
-		if fragmentID != "" {
-			v.fragments[fragmentID] = info
+		return nil
+	})
+	flag.Func("include-dir-override", "Dossier parcouru malgré les défauts, -exclude-dir et -skip-hidden-dirs (ex: static, internal/static); répétable ou séparé par des virgules", func(value string) error {
+		for _, dir := range splitDirList(value) {
+			opts.DirSkips.Included[dir] = true
 		}
-		return nil // Ne pas visiter le corps de la fonction/méthode
-
-	case *ast.GenDecl:
-		if x.Tok == token.TYPE {
-			for _, spec := range x.Specs {
-				typeSpec, ok := spec.(*ast.TypeSpec)
-				if !ok || typeSpec.Name == nil || typeSpec.Name.Name == "_" || typeSpec.Type == nil {
-					continue
-				}
-				// Créer une copie de info pour ce type spécifique
-				currentTypeInfo := info
-				currentTypeInfo.FragmentType = "type"
-				currentTypeInfo.Identifier = typeSpec.Name.Name
-				currentTypeInfo.Docstring = getDocstring(typeSpec.Doc)
-				if currentTypeInfo.Docstring == "" {
-					currentTypeInfo.Docstring = getDocstring(x.Doc)
-				}
-				currentTypeInfo.StartLine = v.fset.Position(typeSpec.Pos()).Line
-				currentTypeInfo.EndLine = v.fset.Position(typeSpec.End()).Line
-
-				// Obtenir la définition formatée du type
-				tempDecl := &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{typeSpec}}
-				formattedDef := formatNode(v.fset, tempDecl)
-				if !strings.HasPrefix(formattedDef, "<!format error") {
-					currentTypeInfo.Definition = strings.TrimSpace(formattedDef)
-				} else {
-					fmt.Fprintf(os.Stderr, "[AST Parser] Avertissement: Échec formatage déf type %s.\n", currentTypeInfo.Identifier)
-					currentTypeInfo.Definition = fmt.Sprintf("type %s [définition brute non formatable]", currentTypeInfo.Identifier)
-				}
-
-				goFileNameWithoutExt := strings.TrimSuffix(filepath.Base(v.currentOriginalPathRel), ".go")
-				currentFragmentID := fmt.Sprintf("%s_%s_type_%s", v.currentPackageName, goFileNameWithoutExt, currentTypeInfo.Identifier)
-
-				var buf bytes.Buffer
-				if err := format.Node(&buf, v.fset, typeSpec); err == nil {
-					sum := sha1.Sum(buf.Bytes())
-					currentTypeInfo.CodeDigest = hex.EncodeToString(sum[:])
-				} else {
-					fmt.Fprintf(os.Stderr, "[AST Parser] Erreur digest type %s: %v\n", currentTypeInfo.Identifier, err)
-				}
-
-				if currentFragmentID != "" {
-					v.fragments[currentFragmentID] = currentTypeInfo
-				}
-			}
-			return nil // Ne pas visiter les enfants du bloc de type
+		return nil
+	})
+	flag.BoolVar(&opts.DirSkips.SkipHidden, "skip-hidden-dirs", opts.DirSkips.SkipHidden, "Ignore les dossiers dont le nom commence par un point (-skip-hidden-dirs=false pour parcourir .config...)")
+	flag.BoolVar(&opts.RespectGitignore, "respect-gitignore", false,
+		"Ignore les fichiers et dossiers exclus par les .gitignore (racine et imbriqués, négations et motifs dossier/ compris); sans .gitignore racine, garde les exclusions par défaut")
+	flag.BoolVar(&opts.CheckUnexportedResults, "check-unexported-results", false,
+		"Marque leaks_unexported_type les fonctions/méthodes exportées dont un résultat utilise un type non exporté du paquet")
+	flag.BoolVar(&opts.DetectLoopCapture, "detect-loop-capture", false,
+		"Marque possible_loop_var_capture les fonctions lançant dans une boucle une goroutine qui capture la variable de boucle (modules < go1.22)")
+	flag.IntVar(&opts.MaxDepth, "max-depth", opts.MaxDepth,
+		"Profondeur maximale des dossiers parcourus sous la racine (0 = racine seule, -1 = illimitée)")
+	nonRecursive := flag.Bool("non-recursive", false,
+		"N'analyse que les .go du dossier donné, sans ses sous-dossiers (comme go build .); équivaut à -max-depth 0")
+	flag.StringVar(&opts.EnrichCmd, "enrich-cmd", "",
+		"Commande shell appelée pour chaque fragment (JSON avec id sur stdin); l'objet JSON qu'elle écrit sur stdout est fusionné dans extra")
+	flag.IntVar(&opts.Jobs, "j", opts.Jobs, "Nombre de fichiers lus, parsés et visités en parallèle (sortie identique quel que soit N)")
+	flag.IntVar(&opts.EnrichJobs, "enrich-jobs", opts.EnrichJobs, "Nombre maximal d'appels simultanés de -enrich-cmd")
+	flag.StringVar(&opts.Query, "query", "",
+		"Interroge un manifeste existant au lieu d'analyser un projet: callers-of <id>, methods-of <type>, fragment <id>")
+	flag.StringVar(&opts.ManifestPath, "manifest", "", "Manifeste JSON interrogé par -query (stdin si absent) ou par -file/-line-range")
+	flag.StringVar(&opts.LineRangeFile, "file", "",
+		"Avec -line-range: ne renvoie que les fragments de ce fichier (relatif à la racine) qui chevauchent la plage")
+	lineRange := flag.String("line-range", "",
+		"Plage START:END (incluse) des fragments à renvoyer pour -file; lit -manifest s'il est fourni, sinon analyse le projet")
+	flag.StringVar(&opts.SpillDir, "spill-dir", "",
+		"Déverse les fragments dans ce dossier au-delà de -spill-threshold et les fusionne à l'écriture (json, json-array); incompatible avec les passes sur le manifeste entier")
+	flag.StringVar(&opts.Digest, "digest", opts.Digest,
+		"Algorithme des digests de contenu (code_digest, digests de fichiers, de paquets et de blocs): sha1, sha256 ou blake2b (BLAKE2b-256); reporté dans digest_algorithm s'il n'est pas sha1")
+	flag.BoolVar(&opts.StdinFiles, "stdin", false,
+		"Analyse uniquement les fichiers .go listés sur l'entrée standard (un chemin par ligne, absolu ou relatif à -root) au lieu de parcourir le dossier; équivalent à passer - comme dossier. Le dossier est tout de même parcouru, par noms seulement, pour que les IDs restent ceux d'une analyse complète (seul l'en-tête des fichiers homonymes est lu; pas avec -id-dir-hash ni -root-relative-ids)")
+	flag.StringVar(&stdinRoot, "root", ".", "Racine du projet avec -stdin: base des chemins relatifs, des IDs et de la recherche des sources .templ")
+	flag.StringVar(&opts.BasePath, "base", "",
+		"Mise à jour incrémentale: réutilise les fragments de ce manifeste (généré avec -file-digests et les mêmes options) pour les paquets dont aucun fichier n'a changé; implique -file-digests")
+	flag.BoolVar(&opts.NDJSON, "ndjson", false,
+		"Écrit chaque fragment sur sa propre ligne JSON (avec id) dès que son fichier est analysé, sans manifeste agrégé; les champs calculés sur le manifeste entier (direct_calls_internal, types_used_internal, effective_methods...) restent vides")
+	flag.IntVar(&opts.SpillThreshold, "spill-threshold", opts.SpillThreshold, "Nombre de fragments gardés en mémoire avant déversement dans -spill-dir")
+	flag.StringVar(&outputPath, "o", "", "Écrit le manifeste (ou le rapport) dans ce fichier au lieu de stdout, dossiers parents créés au besoin; le fichier n'est remplacé que si l'analyse réussit")
+	flag.StringVar(&outputPath, "output", "", "Synonyme de -o")
+	flag.StringVar(&opts.Format, "format", opts.Format, "Format de sortie: json, json-array (fragments en tableau trié avec id), yaml (même manifeste que json), ctags, lsif, html (rapport autonome), github-annotations (commandes ::warning/::notice des fragments signalés par les vérifications actives)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <directory_path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s -query callers-of|methods-of|fragment [-manifest <manifest.json>] <id|type>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s -file <path> -line-range START:END [-manifest <manifest.json> | <directory_path>]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s -batch-diff <manifests.ndjson>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if (opts.LineRangeFile == "") != (*lineRange == "") {
+		fmt.Fprintf(os.Stderr, "[AST Parser] Erreur: -file et -line-range vont ensemble.\n")
+		os.Exit(1)
+	}
+	if *lineRange != "" {
+		start, end, err := parseLineRange(*lineRange)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[AST Parser] Erreur: -line-range %q invalide: %v\n", *lineRange, err)
+			os.Exit(1)
 		}
-		// On pourrait traiter token.CONST et token.VAR ici de manière similaire si besoin.
-		return v
-
-	default:
-		return v
+		opts.LineStart, opts.LineEnd = start, end
 	}
-}
-
-// --- Fonctions Helper (getDocstring, extractImports, buildSignatureString, typeToString, formatNode, sanitizeIdentifier) ---
-// Ces fonctions restent globalement les mêmes que dans les versions précédentes.
-// sanitizeIdentifier n'a plus besoin de base64.
-
-func getDocstring(doc *ast.CommentGroup) string {
-	if doc != nil {
-		return strings.TrimSpace(doc.Text())
+	if flag.NArg() < 1 && opts.BatchDiff == "" && (opts.LineRangeFile == "" || opts.ManifestPath == "") {
+		flag.Usage()
+		os.Exit(1)
 	}
-	return ""
-}
-
-func extractImports(node *ast.File) []ImportInfo {
-	imports := []ImportInfo{}
-	if node == nil {
-		return imports
+	if *nonRecursive {
+		opts.MaxDepth = 0
 	}
-	for _, imp := range node.Imports {
-		var importPath, alias string
-		if imp != nil && imp.Path != nil {
-			importPath = strings.Trim(imp.Path.Value, `"`)
-		}
-		if imp != nil && imp.Name != nil {
-			alias = imp.Name.Name
-		}
-		if importPath != "" {
-			imports = append(imports, ImportInfo{Name: alias, Path: importPath})
+	for _, tag := range strings.Split(*deprecatedTags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			if opts.DeprecatedTags == nil {
+				opts.DeprecatedTags = make(map[string]bool)
+			}
+			opts.DeprecatedTags[tag] = true
 		}
 	}
-	return imports
-}
-
-func buildSignatureString(fset *token.FileSet, f *ast.FuncDecl) string {
-	if f == nil {
-		return "<!nil FuncDecl!>"
-	}
-	signatureOnlyDecl := &ast.FuncDecl{Recv: f.Recv, Name: f.Name, Type: f.Type, Body: nil}
-	var buf bytes.Buffer
-	if err := format.Node(&buf, fset, signatureOnlyDecl); err != nil {
-		fmt.Fprintf(os.Stderr, "[AST Parser] Avertissement: format.Node échec signature %s: %v\n", f.Name.Name, err)
-		// Fallback très simple
-		fbSig := "func "
-		if f.Recv != nil && len(f.Recv.List) > 0 {
-			fbSig += "(" + typeToString(fset, f.Recv.List[0].Type) + ") "
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "build-tags" {
+			return
 		}
-		if f.Name != nil {
-			fbSig += f.Name.Name
-		} else {
-			fbSig += "<anon>"
+		ctx := build.Default
+		ctx.BuildTags = nil
+		for _, tag := range strings.Split(*buildTags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				ctx.BuildTags = append(ctx.BuildTags, tag)
+			}
 		}
-		fbSig += "(...)" // Simplifié
-		if f.Type != nil && f.Type.Results != nil && len(f.Type.Results.List) > 0 {
-			fbSig += " (...)"
+		opts.BuildContext = &ctx
+	})
+	if *nameFilter != "" {
+		re, err := regexp.Compile(*nameFilter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[AST Parser] Erreur: Regex -name-filter %q invalide: %v\n", *nameFilter, err)
+			os.Exit(1)
 		}
-		return fbSig
+		opts.NameFilter = re
 	}
-	return strings.Join(strings.Fields(strings.ReplaceAll(buf.String(), "\n", " ")), " ")
-}
-
-func typeToString(fset *token.FileSet, expr ast.Expr) string {
-	if expr == nil {
-		return "<!nil expr!>"
+	rootDir := flag.Arg(0)
+	if opts.Query == "" && rootDir == "-" {
+		opts.StdinFiles = true
+	}
+	if opts.StdinFiles {
+		rootDir = stdinRoot
 	}
-	return strings.TrimSpace(formatNode(fset, expr))
+	return opts, rootDir, outputPath
 }
 
-func formatNode(fset *token.FileSet, node ast.Node) string {
-	if node == nil {
-		return "<!nil node!>"
-	}
-	var buf bytes.Buffer
-	if err := format.Node(&buf, fset, node); err != nil {
-		if ident, ok := node.(*ast.Ident); ok {
-			return ident.Name
-		} // Fallback pour identifiants simples
-		// Log discret pour les erreurs de formatage de nœuds internes, peut être bruyant
-		// fmt.Fprintf(os.Stderr, "[AST Parser] DEBUG: Erreur format.Node pour type %T: %v\n", node, err)
-		return "<!format error!>"
+// splitDirList découpe une valeur de -exclude-dir ou -include-dir-override en entrées
+// normalisées (barres obliques, sans "./" ni "/" final).
+func splitDirList(value string) []string {
+	var dirs []string
+	for _, dir := range strings.Split(value, ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			dirs = append(dirs, path.Clean(filepath.ToSlash(dir)))
+		}
 	}
-	return buf.String()
+	return dirs
 }
 
-func sanitizeIdentifier(s string) string {
-	if s == "" {
-		return "emptystr"
+// parseLineRange lit une plage START:END de numéros de ligne (1-based, bornes incluses).
+func parseLineRange(value string) (int, int, error) {
+	startText, endText, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("format attendu START:END")
 	}
-	var result strings.Builder
-	for i, r := range s {
-		if unicode.IsLetter(r) || (unicode.IsDigit(r) && i > 0) { // Les identifiants ne commencent pas par un chiffre
-			result.WriteRune(r)
-		} else if r == '*' {
-			result.WriteString("Ptr")
-		} else if r == '[' && i+1 < len(s) && s[i+1] == ']' { // Gérer `[]`
-			result.WriteString("Slice")
-			// On pourrait avancer l'index i ici si on traitait une slice de runes, mais avec range sur string, c'est ok.
-		} else if r == ']' {
-			// Ignoré, géré par le `[]`
-		} else if r == '.' { // Remplacer `.` par `_`
-			result.WriteRune('_')
-		} else if r == '_' { // Conserver les underscores
-			result.WriteRune('_')
-		}
-		// Ignorer les autres caractères
+	start, err := strconv.Atoi(strings.TrimSpace(startText))
+	if err != nil {
+		return 0, 0, err
 	}
-	sanitized := result.String()
-	// Nettoyage des underscores multiples et de début/fin
-	for strings.Contains(sanitized, "__") {
-		sanitized = strings.ReplaceAll(sanitized, "__", "_")
+	end, err := strconv.Atoi(strings.TrimSpace(endText))
+	if err != nil {
+		return 0, 0, err
 	}
-	sanitized = strings.Trim(sanitized, "_")
-
-	if sanitized == "" { // Si tout a été strippé
-		// Fallback simple basé sur un hash court si la sanitization donne une chaîne vide.
-		// Alternative à base64 pour éviter l'import si pas d'autres usages.
-		h := sha1.New()
-		h.Write([]byte(s))
-		return fmt.Sprintf("invalidident_%s", hex.EncodeToString(h.Sum(nil)[:4]))
+	if start < 1 || end < start {
+		return 0, 0, fmt.Errorf("plage vide ou lignes non positives")
 	}
-	return sanitized
+	return start, end, nil
 }
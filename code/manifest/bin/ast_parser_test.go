@@ -0,0 +1,140 @@
+// code/manifest/bin/ast_parser_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/remi-viau/Code-Expert/code/manifest/bin/astparser"
+)
+
+// TestMain exécute main à la place des tests quand runTool relance le binaire de test.
+func TestMain(m *testing.M) {
+	if os.Getenv("AST_PARSER_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runTool lance l'outil avec args et retourne stdout, stderr et son erreur de sortie.
+func runTool(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "AST_PARSER_TEST_MAIN=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// writeProject crée un petit module dans un dossier temporaire et retourne ce dossier.
+func writeProject(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/tool\n\ngo 1.22\n",
+		"main.go": "package main\n\n// Hello salue.\nfunc Hello() string { return \"bonjour\" }\n\nfunc main() { println(Hello()) }\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestOutputFlagWritesJSONFile(t *testing.T) {
+	root := writeProject(t)
+	outputPath := filepath.Join(t.TempDir(), "nouveau", "dossier", "manifest.json")
+	stdout, stderr, err := runTool(t, "-o", outputPath, root)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, stderr)
+	}
+	if stdout != "" {
+		t.Errorf("stdout doit rester vide avec -o: %q", stdout)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest astparser.FragmentManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("JSON invalide dans %s: %v", outputPath, err)
+	}
+	if len(manifest.Fragments) == 0 {
+		t.Errorf("manifeste sans fragments:\n%s", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(outputPath)); len(entries) != 1 {
+		t.Errorf("fichier(s) temporaire(s) laissé(s) à côté de la sortie: %v", entries)
+	}
+}
+
+func TestOutputFlagKeepsPreviousFileOnError(t *testing.T) {
+	root := writeProject(t)
+	outputPath := filepath.Join(t.TempDir(), "manifest.json")
+	if err := os.WriteFile(outputPath, []byte("ancien"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runTool(t, "-o", outputPath, "-format", "inconnu", root); err == nil {
+		t.Fatal("code de sortie nul malgré un -format inconnu")
+	}
+	if data, err := os.ReadFile(outputPath); err != nil || string(data) != "ancien" {
+		t.Errorf("sortie existante modifiée par une analyse en échec: %q, %v", data, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(outputPath)); len(entries) != 1 {
+		t.Errorf("fichier(s) temporaire(s) laissé(s) après l'échec: %v", entries)
+	}
+}
+
+func TestOutputFlagFailsOnUnwritablePath(t *testing.T) {
+	root := writeProject(t)
+	// Un fichier ordinaire ne peut pas servir de dossier parent.
+	blocker := filepath.Join(t.TempDir(), "fichier")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, err := runTool(t, "-o", filepath.Join(blocker, "manifest.json"), root)
+	if err == nil {
+		t.Fatal("code de sortie nul malgré l'échec d'écriture")
+	}
+	if !strings.Contains(stderr, "Erreur -o") {
+		t.Errorf("message d'erreur absent de stderr: %q", stderr)
+	}
+}
+
+func TestStreamingModesAcceptExplicitDefaults(t *testing.T) {
+	root := writeProject(t)
+	spillDir := t.TempDir()
+	for _, args := range [][]string{
+		{"-spill-dir", spillDir, "-key-by", "id", "-format", "json", root},
+		{"-ndjson", "-key-by", "id", "-format", "json", "-max-func-lines", "0", root},
+	} {
+		if _, stderr, err := runTool(t, args...); err != nil {
+			t.Errorf("%v: %v\n%s", args, err, stderr)
+		}
+	}
+	_, stderr, err := runTool(t, "-spill-dir", spillDir, "-key-by", "qualified", "-type-check", root)
+	if err == nil {
+		t.Fatal("-spill-dir accepté avec -type-check")
+	}
+	if !strings.Contains(stderr, "-spill-dir incompatible avec -type-check, -key-by") {
+		t.Errorf("message d'erreur inattendu: %q", stderr)
+	}
+}
+
+func TestNameFilterRejectsInvalidRegex(t *testing.T) {
+	root := writeProject(t)
+	_, stderr, err := runTool(t, "-name-filter", "Handler(", root)
+	if err == nil {
+		t.Fatal("code de sortie nul malgré une regex invalide")
+	}
+	if !strings.Contains(stderr, `Regex -name-filter "Handler(" invalide`) {
+		t.Errorf("message d'erreur inattendu: %q", stderr)
+	}
+}
@@ -0,0 +1,6837 @@
+// code/manifest/bin/astparser/astparser.go
+
+// Package astparser extrait d'un projet Go ses fragments de code (fonctions, méthodes, types,
+// constantes, variables) et leurs métadonnées: docstrings, signatures, digests, appels internes,
+// sources .templ. ParseProject retourne le manifeste; Run pilote en plus les rapports et formats
+// de sortie de la commande ast_parser.
+package astparser
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/build/constraint"
+	"go/constant"
+	"go/doc/comment"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"hash"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"math/bits"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/tools/go/packages"
+	"gopkg.in/yaml.v3"
+)
+
+// FragmentManifest est la structure racine du JSON de sortie.
+type FragmentManifest struct {
+	SchemaVersion   int                     `json:"schema_version"` // Version du schéma du manifeste (cf. manifestSchemaVersion)
+	Fragments       map[string]FragmentInfo `json:"fragments"`
+	FileModTimes    map[string]string       `json:"file_mod_times,omitempty"`   // OriginalPath -> mtime RFC3339 (-record-mtimes)
+	FileHeaders     map[string]string       `json:"file_headers,omitempty"`     // OriginalPath -> commentaire d'en-tête (licence) du fichier, "" si absent (-record-headers)
+	FileStats       map[string]FileStat     `json:"file_stats,omitempty"`       // OriginalPath -> volume du fichier, pour répartir l'indexation (-emit-file-stats)
+	FileDigests     map[string]FileDigest   `json:"file_digests,omitempty"`     // OriginalPath -> digests du fichier, brut et normalisé gofmt (-file-digests)
+	Packages        map[string]PackageInfo  `json:"packages,omitempty"`         // "<répertoire>:<nom>" -> agrégats par paquet
+	Entrypoints     []string                `json:"entrypoints,omitempty"`      // IDs des fonctions main du paquet main
+	ImportTable     []ImportInfo            `json:"import_table,omitempty"`     // Imports distincts du projet, référencés par FragmentInfo.ImportRefs (-intern-imports)
+	NameConflicts   []NameConflict          `json:"name_conflicts,omitempty"`   // Identifiants déclarés à la fois comme type et fonction dans un même paquet
+	DigestAlgorithm string                  `json:"digest_algorithm,omitempty"` // Algorithme des digests de contenu (-digest), absent = sha1
+	// Manifeste delta (-changed-packages-only): paquets identiques à -baseline, avec leur package_digest,
+	// et paquets de -baseline disparus. Fragments et Packages ne contiennent que les paquets modifiés.
+	UnchangedPackages map[string]string `json:"unchanged_packages,omitempty"`
+	RemovedPackages   []string          `json:"removed_packages,omitempty"`
+}
+
+// ValueMember est une constante d'un fragment const_group (-group-const-blocks).
+type ValueMember struct {
+	Name          string `json:"name"`
+	Type          string `json:"type,omitempty"`           // Type déclaré, répété implicitement comme la valeur
+	Value         string `json:"value,omitempty"`          // Expression de la valeur; reprise de la précédente si omise (ex: iota)
+	Doc           string `json:"doc,omitempty"`            // Commentaire de doc, à défaut commentaire de fin de ligne
+	ResolvedValue string `json:"resolved_value,omitempty"` // Valeur calculée par le compilateur, ex: 1 pour iota + 1 (-resolve-const-values)
+}
+
+// FieldInfo est un champ d'un fragment type struct, ou d'une variable de type struct anonyme.
+type FieldInfo struct {
+	Names    []string    `json:"names,omitempty"`    // Noms déclarés ensemble (a, b int); vide pour un champ embarqué
+	Type     string      `json:"type"`               // Type formaté, ex: *sync.Mutex, map[string][]T
+	Tag      string      `json:"tag,omitempty"`      // Tag de struct sans les backquotes, ex: json:"id,omitempty"
+	Embedded bool        `json:"embedded,omitempty"` // Champ embarqué: Type porte le type embarqué
+	Doc      string      `json:"doc,omitempty"`      // Commentaire de doc, à défaut commentaire de fin de ligne
+	Fields   []FieldInfo `json:"fields,omitempty"`   // Variables: champs d'une struct anonyme imbriquée (-anon-struct-fields, maxAnonStructDepth)
+}
+
+// MethodSig est une méthode déclarée explicitement par un fragment type interface.
+type MethodSig struct {
+	Name      string `json:"name"`
+	Signature string `json:"signature"`     // Formatée comme les signatures de fonctions, ex: func Read(p []byte) (n int, err error)
+	Doc       string `json:"doc,omitempty"` // Commentaire de doc, à défaut commentaire de fin de ligne
+}
+
+// TypeParam est un paramètre de type d'une fonction, d'une méthode (via son receveur) ou d'un type.
+type TypeParam struct {
+	Name       string `json:"name"`
+	Constraint string `json:"constraint,omitempty"` // Contrainte formatée (any, comparable, ~int | ~string); pour une méthode, reprise du type receveur
+}
+
+// FragmentEntry est un fragment accompagné de son ID, élément du format -format json-array.
+type FragmentEntry struct {
+	ID string `json:"id"`
+	FragmentInfo
+}
+
+// fragmentArrayManifest est le manifeste émis par -format json-array: fragments remplace
+// la table de FragmentManifest par un tableau trié, les autres champs sont inchangés.
+type fragmentArrayManifest struct {
+	FragmentManifest
+	Fragments []FragmentEntry `json:"fragments"`
+}
+
+// manifestSchemaVersion est la version du schéma émise par cet outil. Elle est incrémentée quand
+// un changement du schéma nécessite une migration des manifestes plus anciens (cf. migrateManifest).
+// Version 0: manifestes antérieurs à l'introduction de schema_version.
+// Version 2: ajout de package_dir.
+const manifestSchemaVersion = 2
+
+// PackageInfo agrège des données sur les fragments d'un paquet (répertoire + nom de paquet).
+type PackageInfo struct {
+	Name          string         `json:"name"`
+	Dir           string         `json:"dir"`                       // Répertoire relatif à la racine ("." pour la racine)
+	ImportUsage   map[string]int `json:"import_usage,omitempty"`    // Chemin d'import -> nombre de fragments qui l'utilisent (-analyze-imports)
+	PackageDigest string         `json:"package_digest,omitempty"`  // Digest (-digest) des CodeDigest triés des fragments du paquet (-package-digests)
+	PublicAPIHash string         `json:"public_api_hash,omitempty"` // Digest (-digest) des signatures canoniques triées des fragments exportés (-api-hashes)
+}
+
+// ImportInfo contient les détails d'une déclaration d'import.
+type ImportInfo struct {
+	Name               string `json:"name,omitempty"`                  // Alias (ex: v pour viper)
+	Path               string `json:"path"`                            // Chemin d'import (ex: "github.com/spf13/viper")
+	IsInternalToModule bool   `json:"is_internal_to_module,omitempty"` // Paquet du module contenant le fichier (-mark-internal-imports)
+}
+
+// FragmentInfo contient les métadonnées d'un fragment de code.
+type FragmentInfo struct {
+	OriginalPath            string                 `json:"original_path"`      // Chemin du fichier .go (ex: main.go, admin_templ.go)
+	ActualSourcePath        string                 `json:"actual_source_path"` // Chemin du .templ si applicable, sinon OriginalPath
+	IsTemplSource           bool                   `json:"is_templ_source"`    // True si ActualSourcePath est un .templ
+	PackageName             string                 `json:"package_name"`
+	PackageDir              string                 `json:"package_dir"`                          // Répertoire de OriginalPath relatif à la racine ("." pour la racine)
+	FragmentType            string                 `json:"fragment_type"`                        // "function", "method", "type", "constant", "variable", "const_group"
+	Identifier              string                 `json:"identifier"`                           // Nom func/methode/type/const/var
+	ReceiverType            string                 `json:"receiver_type,omitempty"`              // Pour méthodes (nom de base seul avec -normalize-receivers)
+	ReceiverName            string                 `json:"receiver_name,omitempty"`              // Pour méthodes: nom du receveur tel qu'écrit ("s", "_"), vide s'il est omis
+	Signature               string                 `json:"signature,omitempty"`                  // Pour funcs/methods
+	Definition              string                 `json:"definition,omitempty"`                 // Pour types, consts, vars
+	Docstring               string                 `json:"docstring,omitempty"`                  // Docstring extrait de l'AST du .go
+	DocstringHTML           string                 `json:"docstring_html,omitempty"`             // Docstring rendu en HTML par go/doc/comment (-render-docs)
+	StartLine               int                    `json:"start_line"`                           // Ligne de début (tient compte des directives //line)
+	EndLine                 int                    `json:"end_line"`                             // Ligne de fin (tient compte des directives //line)
+	RawLine                 int                    `json:"raw_line"`                             // Ligne de début physique dans OriginalPath (ignore //line)
+	RawEndLine              int                    `json:"raw_end_line"`                         // Ligne de fin physique dans OriginalPath (ignore //line)
+	Imports                 []ImportInfo           `json:"imports,omitempty"`                    // Imports du fichier OriginalPath
+	ImportRefs              []int                  `json:"import_refs,omitempty"`                // Indices dans FragmentManifest.ImportTable remplaçant Imports (-intern-imports)
+	CodeDigest              string                 `json:"code_digest,omitempty"`                // Digest (-digest, SHA-1 par défaut) du noeud formaté du fragment dans OriginalPath
+	DirectCallsInternal     []string               `json:"direct_calls_internal,omitempty"`      // Funcs/méthodes: IDs des fonctions du projet appelées (par nom, ou exactement avec -type-check)
+	TypesUsedInternal       []string               `json:"types_used_internal,omitempty"`        // Funcs/méthodes/types: IDs des types du même paquet référencés
+	DirectCallsSamePackage  []string               `json:"direct_calls_same_package,omitempty"`  // Part de DirectCallsInternal dans le même paquet (-split-call-edges)
+	DirectCallsCrossPackage []string               `json:"direct_calls_cross_package,omitempty"` // Part de DirectCallsInternal vers d'autres paquets du projet (-split-call-edges)
+	ImplementedBy           []string               `json:"implemented_by,omitempty"`             // Interfaces: IDs des types du projet qui l'implémentent (-resolve-implementations)
+	EffectiveMethods        []string               `json:"effective_methods,omitempty"`          // Interfaces: méthodes explicites + promues par les interfaces embarquées du projet
+	TooLong                 bool                   `json:"too_long,omitempty"`                   // Funcs/méthodes: EndLine - StartLine dépasse -max-func-lines
+	TooManyParams           bool                   `json:"too_many_params,omitempty"`            // Funcs/méthodes: plus de -max-params paramètres (receveur exclu)
+	ChunkDigests            []string               `json:"chunk_digests,omitempty"`              // Funcs/méthodes de plus de -chunk-lines lignes: digest (-digest) de chaque bloc de N lignes du code formaté
+	CommentLines            int                    `json:"comment_lines,omitempty"`              // Lignes portant un commentaire dans l'étendue du fragment (-comment-density)
+	CommentDensity          float64                `json:"comment_density,omitempty"`            // CommentLines / nombre total de lignes du fragment
+	ImportsUsed             []string               `json:"imports_used,omitempty"`               // Chemins des imports du fichier réellement référencés par le fragment (-analyze-imports)
+	IsEntrypoint            bool                   `json:"is_entrypoint,omitempty"`              // Fonction main du paquet main
+	ReceiverIsPointer       bool                   `json:"receiver_is_pointer,omitempty"`        // Méthodes: receveur pointeur (-normalize-receivers)
+	ReceiverTypeParams      string                 `json:"receiver_type_params,omitempty"`       // Méthodes: paramètres de type du receveur, ex: "[K, V]" (-normalize-receivers)
+	CanonicalSignature      string                 `json:"canonical_signature,omitempty"`        // Funcs/méthodes: type de fonction sans noms de paramètres (-canonical-signatures)
+	StructSize              int                    `json:"struct_size,omitempty"`                // Structs: taille en octets (-check-alignment, gc/amd64)
+	FieldAlignmentSavings   int                    `json:"field_alignment_savings,omitempty"`    // Structs: octets gagnés en réordonnant les champs (-check-alignment)
+	IsGeneric               bool                   `json:"is_generic,omitempty"`                 // Funcs, méthodes (receveur générique) et types déclarant des paramètres de type
+	TypeParams              []TypeParam            `json:"type_params,omitempty"`                // Paramètres de type dans l'ordre de déclaration (fragments génériques)
+	UnderlyingKind          string                 `json:"underlying_kind,omitempty"`            // Types: struct, interface, map, slice, array, chan, func, pointer ou basic ("" si non résolu)
+	ModulePath              string                 `json:"module_path,omitempty"`                // Module remplacé (directive replace locale) auquel appartient le fragment (-follow-replaces)
+	Undocumented            bool                   `json:"undocumented,omitempty"`               // Fragment exporté sans Docstring
+	PossibleLockLeak        bool                   `json:"possible_lock_leak,omitempty"`         // Funcs/méthodes: Lock()/RLock() sans Unlock()/RUnlock() correspondant (heuristique, -detect-lock-leaks)
+	LeaksUnexportedType     bool                   `json:"leaks_unexported_type,omitempty"`      // Funcs/méthodes exportées retournant un type non exporté du paquet (-check-unexported-results)
+	DeprecatedByTag         bool                   `json:"deprecated_by_tag,omitempty"`          // Fichier contraint par une des build tags de -deprecated-tags
+	OrphanedReceiver        bool                   `json:"orphaned_receiver,omitempty"`          // Méthodes dont le type receveur n'a pas de fragment type dans le paquet
+	PossibleLoopVarCapture  bool                   `json:"possible_loop_var_capture,omitempty"`  // Funcs/méthodes: go func(){...}() dans une boucle utilisant sa variable (heuristique, -detect-loop-capture)
+	FileSymbols             []string               `json:"file_symbols,omitempty"`               // Symboles déclarés dans le même OriginalPath, méthodes en Type.Méthode (-with-file-symbols)
+	FuzzyDigest             string                 `json:"fuzzy_digest,omitempty"`               // SimHash 64 bits (hex) du flux de jetons normalisé: proche pour du code similaire (-fuzzy-digests)
+	Extra                   map[string]interface{} `json:"extra,omitempty"`                      // Métadonnées ajoutées par la commande -enrich-cmd
+	HasTest                 bool                   `json:"has_test,omitempty"`                   // Funcs/méthodes appelées depuis un fichier _test.go du projet (-detect-untested)
+	IsTest                  bool                   `json:"is_test,omitempty"`                    // Fragment déclaré dans un fichier _test.go (-include-tests)
+	IsTestExport            bool                   `json:"is_test_export,omitempty"`             // Fragment déclaré dans export_test.go: exposé aux seuls tests du paquet, hors API publique (-include-tests)
+	TestKind                string                 `json:"test_kind,omitempty"`                  // Funcs de _test.go: test, benchmark, fuzz ou example selon le préfixe du nom (-include-tests)
+	Members                 []ValueMember          `json:"members,omitempty"`                    // const_group: constantes du bloc, dans l'ordre (-group-const-blocks)
+	ResolvedValue           string                 `json:"resolved_value,omitempty"`             // Constantes: valeur calculée par le compilateur, ex: 1 pour StatusActive = iota + 1 (-resolve-const-values)
+	Fields                  []FieldInfo            `json:"fields,omitempty"`                     // Structs, et variables de type struct anonyme (-anon-struct-fields): champs dans l'ordre de déclaration
+	EmbedPatterns           []string               `json:"embed_patterns,omitempty"`             // Variables: motifs des directives //go:embed, dans l'ordre (ex: static/*, templates/index.html)
+	Methods                 []MethodSig            `json:"methods,omitempty"`                    // Interfaces, et variables de type interface anonyme (-anon-struct-fields): méthodes explicites dans l'ordre de déclaration
+	EmbeddedInterfaces      []string               `json:"embedded_interfaces,omitempty"`        // Interfaces: interfaces et contraintes embarquées telles qu'écrites (io.Reader, ~int | ~string)
+	AmbiguousMethods        []string               `json:"ambiguous_methods,omitempty"`          // Structs: méthodes promues par plusieurs types embarqués à la même profondeur (sélecteur ambigu)
+	GeneratedBy             string                 `json:"generated_by,omitempty"`               // Fragments de fichiers générés: directive //go:generate probable, "fichier.go:ligne: commande" (-link-generated)
+	IsGenerated             bool                   `json:"is_generated,omitempty"`               // OriginalPath porte l'en-tête // Code generated ... DO NOT EDIT. (_templ.go compris: cf. IsTemplSource)
+	BuildContext            string                 `json:"build_context,omitempty"`              // GOOS/GOARCH sous lesquels le fichier a été retenu (-build-tags)
+
+	// Données internes aux passes post-parcours (non sérialisées).
+	canonicalFuncType string            // Méthodes: type de fonction sans noms de paramètres
+	isInterface       bool              // Types: true si le type sous-jacent est une interface
+	ifaceMethods      map[string]string // Interfaces: méthodes explicites -> type de fonction canonique
+	ifaceEmbeds       []string          // Interfaces: éléments embarqués (interfaces, contraintes) tels qu'écrits
+	structFields      []string          // Structs: noms des champs, champs embarqués compris
+	structEmbeds      []string          // Structs: noms de base des types embarqués du paquet (hors types qualifiés)
+	effectiveMethods  map[string]string // Interfaces: ensemble de méthodes effectif (résolu après le parcours)
+	effectiveComplete bool              // Interfaces: true si tous les éléments embarqués ont été résolus
+	nameLine          int               // Ligne physique de l'identifiant déclaré (pour -format lsif)
+	nameColumn        int               // Colonne (octets, à partir de 1) de l'identifiant déclaré
+	importPath        string            // Chemin d'import du paquet (pour -key-by qualified)
+	resultTypeNames   []string          // Funcs/méthodes: identifiants de types locaux cités dans les résultats
+	apiSignature      string            // Fragments exportés: forme canonique de l'API (noms + types, sans corps ni commentaires)
+	underlyingRef     string            // Types: type local dont le type sous-jacent est hérité (type A B, type A = B)
+	fuzzyTokens       int               // Nombre de jetons normalisés ayant servi à FuzzyDigest
+	paramCount        int               // Funcs/méthodes: nombre de paramètres, groupés comptés un à un, receveur exclu
+	callRefs          []callRef         // Funcs/méthodes: appels f() et pkg.F() du corps, résolus après le parcours
+	typeRefs          []string          // Funcs/méthodes/types: identifiants non qualifiés en position de type
+}
+
+// Options regroupe les options de l'analyse. Le commentaire de chaque champ cite le flag de la
+// commande ast_parser correspondant. Partir de DefaultOptions: la valeur zéro n'exclut aucun
+// dossier et limite le parcours à la racine (MaxDepth 0).
+type Options struct {
+	Logger                  Logger          // Messages de progression et avertissements (nil = stderr)
+	Stdin                   io.Reader       // Liste des fichiers de StdinFiles (nil = os.Stdin)
+	ResolveImplementations  bool            // -resolve-implementations: types du projet implémentant chaque interface (ImplementedBy)
+	RootRelativeIDs         bool            // -root-relative-ids: IDs préfixés par le répertoire du fichier
+	IDDirHash               bool            // -id-dir-hash: hash court du répertoire ajouté à la base des IDs
+	NameFilter              *regexp.Regexp  // -name-filter: ne garder que les fragments dont l'Identifier correspond
+	ExportedOnly            bool            // -exported-only: ne garder que les fragments exportés
+	KeepUnexportedReceivers bool            // -keep-unexported-receivers: avec ExportedOnly, garder les méthodes exportées de types non exportés
+	TypeCheck               bool            // -type-check: appels résolus par go/types (go/packages) plutôt que par noms
+	RecordMtimes            bool            // -record-mtimes: FileModTimes du manifeste
+	RecordHeaders           bool            // -record-headers: FileHeaders du manifeste
+	EmitFileStats           bool            // -emit-file-stats: FileStats du manifeste
+	FileDigests             bool            // -file-digests: FileDigests du manifeste
+	WithFileSymbols         bool            // -with-file-symbols: FileSymbols, symboles déclarés dans le même fichier
+	EnrichCmd               string          // -enrich-cmd: commande shell appelée par fragment pour renseigner Extra
+	EnrichJobs              int             // -enrich-jobs: nombre d'appels simultanés de -enrich-cmd
+	Jobs                    int             // -j: nombre de fichiers parsés simultanément
+	BatchDiff               string          // -batch-diff: fichier NDJSON de manifestes à comparer deux à deux
+	MaxFuncLines            int             // -max-func-lines: 0 = pas de vérification
+	MaxParams               int             // -max-params: 0 = pas de vérification
+	ChunkLines              int             // -chunk-lines: 0 = pas de digests par bloc
+	GroupConstBlocks        bool            // -group-const-blocks: un fragment const_group par bloc const (...)
+	AnonStructFields        bool            // -anon-struct-fields: champs des variables de type struct ou interface anonyme
+	ResolveConstValues      bool            // -resolve-const-values: ResolvedValue des constantes, via go/types
+	SplitCallEdges          bool            // -split-call-edges: appels répartis entre même paquet et autres paquets
+	DetectUntested          bool            // -detect-untested: HasTest et résumé des fonctions exportées sans test; implique TypeCheck
+	IncludeTests            bool            // -include-tests: fragments des _test.go (IsTest, TestKind)
+	SpillDir                string          // -spill-dir: dossier des lots de fragments déversés sur disque ("" = tout en mémoire)
+	SpillThreshold          int             // -spill-threshold: nombre de fragments en mémoire déclenchant un déversement
+	NDJSON                  bool            // -ndjson: un fragment par ligne JSON, écrit au fil du parcours
+	BasePath                string          // -base: manifeste précédent dont les fichiers inchangés sont réutilisés sans parsing
+	StdinFiles              bool            // -stdin (ou dossier "-"): fichiers à analyser lus sur l'entrée standard
+	Digest                  string          // -digest: algorithme des digests de contenu (sha1, sha256, blake2b)
+	CheckIDs                bool            // -check-ids: rapport des IDs produits par plusieurs déclarations
+	DetectImportCycles      bool            // -detect-import-cycles: rapport des cycles d'imports entre paquets du projet
+	FailOnCycle             bool            // -fail-on-cycle: avec DetectImportCycles, ErrChecksFailed si un cycle est trouvé
+	LinkGenerated           bool            // -link-generated: GeneratedBy des fragments de fichiers générés
+	FailOnLongFunc          bool            // -fail-on-long-func: avec MaxFuncLines, ErrChecksFailed si une fonction est trop longue
+	FindDuplicates          bool            // -find-duplicates: rapport des fragments de même CodeDigest
+	GroupByMethodName       bool            // -group-by-method-name: rapport des méthodes regroupées par nom
+	FuzzyDigests            bool            // -fuzzy-digests: FuzzyDigest (SimHash) de chaque fragment
+	FindSimilar             float64         // -find-similar: seuil de similarité (0-1] des groupes émis, 0 = désactivé
+	CommentDensity          bool            // -comment-density: CommentLines et CommentDensity par fragment
+	ExcludeGenerated        bool            // -exclude-generated: fichiers de code généré ignorés sans parsing
+	AnalyzeImports          bool            // -analyze-imports: ImportsUsed par fragment et ImportUsage par paquet
+	Format                  string          // -format: json (défaut), json-array, yaml, ctags, lsif, html ou github-annotations (cf. normalize); NDJSON le remplace
+	PackageDigests          bool            // -package-digests: PackageDigest de chaque paquet
+	ChangedPackagesOnly     bool            // -changed-packages-only: seuls les paquets modifiés depuis BaselinePath; implique PackageDigests
+	BaselinePath            string          // -baseline: manifeste de référence de -changed-packages-only
+	APIHashes               bool            // -api-hashes: PublicAPIHash de chaque paquet
+	NormalizeReceivers      bool            // -normalize-receivers: ReceiverType réduit au nom de base (pointeur et paramètres à part)
+	DryRun                  bool            // -dry-run: rapport des fichiers qui seraient analysés et ignorés, sans parsing
+	CanonicalSignatures     bool            // -canonical-signatures: CanonicalSignature des fonctions et méthodes
+	CheckAlignment          bool            // -check-alignment: StructSize et FieldAlignmentSavings des structs, via go/types
+	FollowReplaces          bool            // -follow-replaces: analyser aussi les cibles locales des directives replace
+	MarkInternalImports     bool            // -mark-internal-imports: IsInternalToModule des imports
+	RenderDocs              bool            // -render-docs: DocstringHTML, docstring rendue par go/doc/comment
+	Query                   string          // -query: callers-of, methods-of, fragment
+	ManifestPath            string          // -manifest: manifeste interrogé par -query ("" = stdin)
+	LineRangeFile           string          // -file: fichier dont -line-range sélectionne les fragments
+	LineStart, LineEnd      int             // -line-range START:END (bornes incluses)
+	StripPrefix             string          // -strip-prefix: préfixe retiré de OriginalPath/ActualSourcePath (relatif à la racine)
+	MinDocCoverage          float64         // -min-doc-coverage: pourcentage minimal de fragments exportés documentés (0 = pas de vérification)
+	KeyBy                   string          // -key-by: id (défaut) ou qualified
+	DetectLockLeaks         bool            // -detect-lock-leaks: PossibleLockLeak des fonctions sans Unlock
+	InternImports           bool            // -intern-imports: ImportRefs vers la table ImportTable du manifeste
+	DirtyOnly               bool            // -dirty-only: n'analyser que les .go modifiés du dépôt git
+	RespectGitignore        bool            // -respect-gitignore: ignorer les chemins exclus par les .gitignore
+	DirSkips                DirSkipRules    // Dossiers ignorés: défauts, -exclude-dir, -include-dir-override, -skip-hidden-dirs
+	CheckUnexportedResults  bool            // -check-unexported-results: LeaksUnexportedType des fonctions exportées
+	DeprecatedTags          map[string]bool // -deprecated-tags: build tags marquant du code en voie de suppression
+	BuildContext            *build.Context  // -build-tags: contexte filtrant les fichiers par contraintes de build (nil = tous les fichiers)
+	DetectLoopCapture       bool            // -detect-loop-capture: PossibleLoopVarCapture des goroutines lancées en boucle
+	MaxDepth                int             // -max-depth: profondeur maximale des dossiers parcourus sous la racine (-1 = illimitée)
+}
+
+// ManifestDiff résume les différences de fragments entre deux manifestes successifs.
+type ManifestDiff struct {
+	From    int      `json:"from"`    // Index (à partir de 0) du manifeste de départ dans le lot
+	To      int      `json:"to"`      // Index du manifeste d'arrivée
+	Added   []string `json:"added"`   // IDs présents uniquement dans le manifeste d'arrivée
+	Removed []string `json:"removed"` // IDs présents uniquement dans le manifeste de départ
+	Changed []string `json:"changed"` // IDs présents dans les deux avec un CodeDigest différent
+}
+
+// DuplicateCluster regroupe les fragments dont le code formaté est identique (-find-duplicates).
+type DuplicateCluster struct {
+	CodeDigest  string   `json:"code_digest"`
+	FragmentIDs []string `json:"fragment_ids"`
+}
+
+// FileStat mesure le volume d'un fichier .go analysé (-emit-file-stats).
+type FileStat struct {
+	Fragments int   `json:"fragments"` // Nombre de fragments émis pour le fichier
+	Lines     int   `json:"lines"`     // Nombre total de lignes du fichier
+	Bytes     int64 `json:"bytes"`     // Taille du fichier en octets
+}
+
+// FileDigest porte les digests d'un fichier .go (-file-digests).
+type FileDigest struct {
+	Digest       string `json:"digest"`                  // Digest (-digest) des octets bruts: change à toute modification
+	FormatDigest string `json:"format_digest,omitempty"` // Digest (-digest) du contenu normalisé par gofmt: insensible au formatage
+}
+
+// NameConflict signale un identifiant déclaré sous plusieurs genres (type et fonction) dans
+// un même paquet: illégal en Go, mais possible entre fichiers à build tags exclusives ou
+// dans une entrée invalide.
+type NameConflict struct {
+	Package     string   `json:"package"` // Clé de paquet "<répertoire>:<nom>"
+	Identifier  string   `json:"identifier"`
+	FragmentIDs []string `json:"fragment_ids"`
+}
+
+// SimilarCluster regroupe des fragments au code proche selon leur FuzzyDigest (-find-similar).
+type SimilarCluster struct {
+	FragmentIDs   []string `json:"fragment_ids"`
+	MinSimilarity float64  `json:"min_similarity"` // Plus faible similarité des paires ayant formé le groupe
+}
+
+// IDClaim est une déclaration ayant produit un ID de fragment (-check-ids).
+type IDClaim struct {
+	OriginalPath string `json:"original_path"`
+	Identifier   string `json:"identifier"`
+	FragmentType string `json:"fragment_type"`
+	StartLine    int    `json:"start_line"`
+}
+
+// IDCollision liste les déclarations concurrentes d'un même ID de fragment: seule la
+// dernière parcourue subsiste dans le manifeste.
+type IDCollision struct {
+	ID     string    `json:"id"`
+	Claims []IDClaim `json:"claims"`
+}
+
+// goGenerateDirective est une directive //go:generate relevée pendant le parcours (-link-generated).
+type goGenerateDirective struct {
+	file    string // OriginalPath du fichier contenant la directive
+	line    int
+	command string // Commande après "//go:generate "
+}
+
+// MethodGroupEntry est une implémentation d'une méthode dans le rapport -group-by-method-name.
+type MethodGroupEntry struct {
+	ReceiverType string `json:"receiver_type"`
+	PackageDir   string `json:"package_dir"`
+	FragmentID   string `json:"fragment_id"`
+}
+
+// DryRunReport liste ce qu'une analyse traiterait, sans rien parser (-dry-run).
+type DryRunReport struct {
+	Files   []string      `json:"files"`   // Fichiers .go qui seraient parsés
+	Skipped []SkippedPath `json:"skipped"` // Dossiers (suffixés par "/") et fichiers .go ignorés
+}
+
+// SkippedPath est un chemin ignoré par le parcours, avec la raison.
+type SkippedPath struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// skip enregistre un chemin ignoré; sans effet hors dry-run (récepteur nil).
+func (r *DryRunReport) skip(relPath, reason string) {
+	if r != nil {
+		r.Skipped = append(r.Skipped, SkippedPath{Path: relPath, Reason: reason})
+	}
+}
+
+// visitor pour parcourir l'AST
+type visitor struct {
+	fset                        *token.FileSet
+	fragments                   map[string]FragmentInfo
+	currentOriginalPathRel      string // Chemin relatif du fichier .go en cours d'analyse
+	currentActualSourcePathRel  string // Chemin relatif du .templ source si applicable
+	currentIsTemplSource        bool   // True si on traite le source .templ
+	currentPackageName          string
+	currentFileImports          []ImportInfo
+	projectRootDirAbs           string // Racine absolue du projet pour résoudre les chemins .templ
+	opts                        *Options
+	currentCommentLines         map[int]bool          // Lignes physiques portant un commentaire (-comment-density)
+	declIDs                     map[*ast.Ident]string // Identifiant déclaré -> ID de fragment (passes go/types)
+	currentModulePath           string                // Module remplacé en cours d'analyse ("" = module racine)
+	currentImportPath           string                // Chemin d'import du paquet en cours d'analyse
+	currentDeprecatedByTag      bool                  // Le fichier en cours porte une des -deprecated-tags
+	currentPerIterationLoopVars bool                  // Le module du fichier déclare go >= 1.22 (variables de boucle par itération)
+	currentIsTestFile           bool                  // Fichier _test.go (-include-tests)
+	currentIsTestExportFile     bool                  // Fichier export_test.go (-include-tests)
+	currentIsGenerated          bool                  // Fichier portant l'en-tête // Code generated ... DO NOT EDIT.
+	filteredUnexported          int                   // Fragments écartés par -exported-only dans le fichier
+	idClaims                    map[string][]IDClaim  // ID -> déclarations l'ayant produit (-check-ids), nil sinon
+}
+
+// parsedFile conserve un fichier parsé pour les passes qui ont besoin de l'AST après le parcours.
+type parsedFile struct {
+	relPath    string // Chemin relatif du .go (OriginalPath)
+	node       *ast.File
+	importPath string // Chemin d'import du paquet contenant le fichier
+	isTest     bool   // Fichier _test.go (-detect-untested): vérifié avec son paquet, sans fragments
+}
+
+// fileJob est un fichier .go découvert par le parcours: lu, parsé et visité par un worker (-j),
+// puis fusionné dans le manifeste dans l'ordre du parcours.
+type fileJob struct {
+	path                 string // Chemin absolu
+	relPath              string // OriginalPath (chemin relatif au dossier racine pour un _test.go)
+	fileinfo             os.FileInfo
+	importPath           string // Chemin d'import du paquet contenant le fichier
+	modulePath           string // Module du parcours en cours (racine ou remplacé)
+	replacedModule       string // Module remplacé en cours ("" = module racine)
+	perIterationLoopVars bool
+	isTest               bool          // Fichier _test.go parsé pour -detect-untested
+	testFragments        bool          // Fichier _test.go analysé comme les autres (-include-tests)
+	forceParse           bool          // Parsing exigé même si -base a le fichier inchangé
+	done                 chan struct{} // Fermé quand result est prêt
+	result               fileResult
+}
+
+// fileResult est ce que produit le traitement d'un fichier, avant fusion dans le manifeste.
+type fileResult struct {
+	skipPath, skipReason string // Fichier ou dossier exclu (rapport -dry-run)
+	dryRunFile           bool   // Fichier qui serait analysé (-dry-run)
+	reused               bool   // Fichier inchangé depuis -base: fragments repris sans parsing
+	filteredUnexported   int    // Fragments écartés par -exported-only
+	idBase               string // Base des IDs du fichier (cf. idBaseClaims)
+	baseSuffixed         bool   // Fichier repris de -base dont les IDs y portaient le suffixe de idBaseClaims
+	node                 *ast.File
+	header               string
+	digest               FileDigest
+	stat                 FileStat
+	directives           []goGenerateDirective
+	generated            bool
+	imports              []ImportInfo
+	fragments            map[string]FragmentInfo
+	declIDs              map[*ast.Ident]string
+	idClaims             map[string][]IDClaim
+}
+
+// incrementalBase est le manifeste précédent d'une mise à jour incrémentale (-base). Un fichier
+// dont le digest brut est inchangé reprend ses fragments sans être parsé, sauf si un autre
+// fichier de son dossier (paquet) a changé, a été ajouté ou supprimé.
+type incrementalBase struct {
+	manifest        FragmentManifest
+	fragmentsByFile map[string]map[string]FragmentInfo // OriginalPath -> ID -> fragment
+	seen            map[string]bool                    // Fichiers rencontrés au parcours
+	dirtyDirs       map[string]bool                    // Dossiers ayant un fichier modifié, ajouté ou supprimé
+	reused          []*fileJob                         // Fichiers repris de la base, dans l'ordre du parcours
+	idsChanged      bool                               // Un fichier repris change d'IDs (cf. idBaseClaims): tout est reparsé
+	parsed          int
+}
+
+func newIncrementalBase(manifest FragmentManifest) *incrementalBase {
+	b := &incrementalBase{
+		manifest:        manifest,
+		fragmentsByFile: make(map[string]map[string]FragmentInfo),
+		seen:            make(map[string]bool),
+		dirtyDirs:       make(map[string]bool),
+	}
+	for id, info := range manifest.Fragments {
+		if b.fragmentsByFile[info.OriginalPath] == nil {
+			b.fragmentsByFile[info.OriginalPath] = make(map[string]FragmentInfo)
+		}
+		b.fragmentsByFile[info.OriginalPath][id] = info
+	}
+	return b
+}
+
+// record note un fichier fusionné, repris ou parsé.
+func (b *incrementalBase) record(job *fileJob) {
+	b.seen[job.relPath] = true
+	if job.result.reused {
+		b.reused = append(b.reused, job)
+		return
+	}
+	b.parsed++
+	b.dirtyDirs[path.Dir(job.relPath)] = true
+}
+
+// staleReused retourne, dans l'ordre du parcours, les fichiers repris dont le dossier a changé.
+// Un fichier de la base absent du parcours (supprimé) rend son dossier modifié.
+func (b *incrementalBase) staleReused() []*fileJob {
+	for relPath := range b.manifest.FileDigests {
+		if !b.seen[relPath] {
+			b.dirtyDirs[path.Dir(relPath)] = true
+		}
+	}
+	var stale []*fileJob
+	for _, job := range b.reused {
+		if b.idsChanged || b.dirtyDirs[path.Dir(job.relPath)] {
+			stale = append(stale, job)
+		}
+	}
+	return stale
+}
+
+// dropDanglingCalls retire de DirectCallsInternal les IDs absents du manifeste.
+func dropDanglingCalls(fragments map[string]FragmentInfo) {
+	for id, info := range fragments {
+		kept := info.DirectCallsInternal[:0:0]
+		for _, callee := range info.DirectCallsInternal {
+			if _, ok := fragments[callee]; ok {
+				kept = append(kept, callee)
+			}
+		}
+		if len(kept) != len(info.DirectCallsInternal) {
+			info.DirectCallsInternal = kept
+			fragments[id] = info
+		}
+	}
+}
+
+// localReplace est la cible locale d'une directive replace du go.mod racine.
+type localReplace struct {
+	modulePath string // Chemin du module remplacé
+	dirAbs     string // Répertoire absolu du module de remplacement
+}
+
+// --- API de la bibliothèque ---
+
+// Logger reçoit les messages de progression et les avertissements de l'analyse. *log.Logger
+// le satisfait; sans Options.Logger, les messages vont sur stderr préfixés par "[AST Parser] ".
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+var stderrLogger Logger = log.New(os.Stderr, "[AST Parser] ", 0)
+
+// logger retourne le journal des messages de l'analyse.
+func (o *Options) logger() Logger {
+	if o.Logger == nil {
+		return stderrLogger
+	}
+	return o.Logger
+}
+
+// ErrChecksFailed est retournée par Run quand une vérification demandée échoue (-check-ids,
+// -fail-on-cycle, -fail-on-long-func, -min-doc-coverage). Le détail est déjà dans le journal.
+var ErrChecksFailed = errors.New("vérification échouée")
+
+// DefaultOptions retourne les options par défaut de la ligne de commande: dossiers exclus par
+// défaut (vendor, node_modules...) et dossiers cachés ignorés, profondeur illimitée, digests SHA-1,
+// un worker par processeur.
+func DefaultOptions() Options {
+	opts := Options{
+		DirSkips:       DirSkipRules{Excluded: make(map[string]string), Included: make(map[string]bool), SkipHidden: true},
+		Jobs:           runtime.GOMAXPROCS(0),
+		EnrichJobs:     runtime.NumCPU(),
+		SpillThreshold: 50000,
+		Digest:         "sha1",
+		Format:         "json",
+		KeyBy:          "id",
+		MaxDepth:       -1,
+	}
+	for name, reason := range defaultSkippedDirs {
+		opts.DirSkips.Excluded[name] = reason
+	}
+	return opts
+}
+
+// normalize complète les champs laissés vides, applique les implications entre options et
+// rejette les valeurs inconnues ou les combinaisons impossibles.
+func (o *Options) normalize() error {
+	if o.Digest == "" {
+		o.Digest = "sha1"
+	}
+	if o.Format == "" {
+		o.Format = "json"
+	}
+	if o.KeyBy == "" {
+		o.KeyBy = "id"
+	}
+	if o.Jobs < 1 {
+		o.Jobs = runtime.GOMAXPROCS(0)
+	}
+	if o.EnrichJobs < 1 {
+		o.EnrichJobs = runtime.NumCPU()
+	}
+	if o.SpillThreshold == 0 {
+		o.SpillThreshold = 50000
+	}
+	switch o.Query {
+	case "", "callers-of", "methods-of", "fragment":
+	default:
+		return fmt.Errorf("requête %q inconnue (callers-of, methods-of, fragment)", o.Query)
+	}
+	switch o.Format {
+	case "json", "json-array", "yaml", "ctags", "lsif", "html", "github-annotations":
+	default:
+		return fmt.Errorf("format de sortie %q inconnu (json, json-array, yaml, ctags, lsif, html, github-annotations)", o.Format)
+	}
+	if _, ok := digestAlgorithms[o.Digest]; !ok {
+		return fmt.Errorf("algorithme -digest %q inconnu (sha1, sha256, blake2b)", o.Digest)
+	}
+	switch o.KeyBy {
+	case "id", "qualified":
+	default:
+		return fmt.Errorf("mode -key-by %q inconnu (id, qualified)", o.KeyBy)
+	}
+	if o.SpillDir != "" {
+		if o.Format != "json" && o.Format != "json-array" {
+			return fmt.Errorf("-spill-dir ne produit que les formats json et json-array")
+		}
+		if o.SpillThreshold < 1 {
+			return fmt.Errorf("-spill-threshold doit être positif")
+		}
+	}
+	if o.BasePath != "" {
+		if o.NDJSON || o.SpillDir != "" || o.StdinFiles || o.DirtyOnly {
+			return fmt.Errorf("-base incompatible avec -ndjson, -spill-dir, -stdin et -dirty-only")
+		}
+		o.FileDigests = true
+	}
+	if o.NDJSON && (o.Format != "json" || o.SpillDir != "") {
+		return fmt.Errorf("-ndjson remplace -format et -spill-dir")
+	}
+	if o.ChangedPackagesOnly != (o.BaselinePath != "") {
+		return fmt.Errorf("-changed-packages-only et -baseline vont ensemble")
+	}
+	// Avant les implications: -detect-untested ne doit pas être signalé comme -type-check.
+	for _, mode := range []struct {
+		name string
+		set  bool
+	}{{"-spill-dir", o.SpillDir != ""}, {"-base", o.BasePath != ""}, {"-ndjson", o.NDJSON}} {
+		if conflicts := o.wholeManifestOptions(); mode.set && len(conflicts) > 0 {
+			return fmt.Errorf("%s incompatible avec %s (passes sur le manifeste entier)", mode.name, strings.Join(conflicts, ", "))
+		}
+	}
+	if o.FindSimilar > 0 {
+		o.FuzzyDigests = true
+	}
+	if o.ChangedPackagesOnly {
+		o.PackageDigests = true
+	}
+	if o.DetectUntested {
+		o.TypeCheck = true
+	}
+	return nil
+}
+
+// wholeManifestOptions retourne les options demandées dont les passes ont besoin de tous les
+// fragments en mémoire après le parcours, et qui ne se combinent donc pas avec -spill-dir,
+// -base ni -ndjson. Seules les valeurs comptent: -key-by id, la valeur par défaut, passe.
+func (o *Options) wholeManifestOptions() []string {
+	var names []string
+	for _, opt := range []struct {
+		name string
+		set  bool
+	}{
+		{"-type-check", o.TypeCheck},
+		{"-check-alignment", o.CheckAlignment},
+		{"-resolve-const-values", o.ResolveConstValues},
+		{"-split-call-edges", o.SplitCallEdges},
+		{"-detect-untested", o.DetectUntested},
+		{"-resolve-implementations", o.ResolveImplementations},
+		{"-analyze-imports", o.AnalyzeImports},
+		{"-package-digests", o.PackageDigests},
+		{"-api-hashes", o.APIHashes},
+		{"-link-generated", o.LinkGenerated},
+		{"-with-file-symbols", o.WithFileSymbols},
+		{"-emit-file-stats", o.EmitFileStats},
+		{"-max-func-lines", o.MaxFuncLines > 0},
+		{"-fail-on-long-func", o.FailOnLongFunc},
+		{"-max-params", o.MaxParams > 0},
+		{"-check-unexported-results", o.CheckUnexportedResults},
+		{"-min-doc-coverage", o.MinDocCoverage > 0},
+		{"-key-by", o.KeyBy != "id"},
+		{"-intern-imports", o.InternImports},
+		{"-enrich-cmd", o.EnrichCmd != ""},
+		{"-file", o.LineRangeFile != ""},
+		{"-line-range", o.LineStart != 0 || o.LineEnd != 0},
+		{"-check-ids", o.CheckIDs},
+		{"-dry-run", o.DryRun},
+		{"-changed-packages-only", o.ChangedPackagesOnly},
+		{"-render-docs", o.RenderDocs},
+		{"-detect-import-cycles", o.DetectImportCycles},
+		{"-group-by-method-name", o.GroupByMethodName},
+		{"-find-similar", o.FindSimilar > 0},
+		{"-find-duplicates", o.FindDuplicates},
+	} {
+		if opt.set {
+			names = append(names, opt.name)
+		}
+	}
+	return names
+}
+
+// needsTypeCheck indique si une passe go/types est demandée: les fichiers parsés sont alors
+// gardés jusqu'à la vérification des types, après le parcours.
+func (o *Options) needsTypeCheck() bool {
+	return o.TypeCheck || o.CheckAlignment || o.ResolveConstValues
+}
+
+// reportMode retourne l'option qui remplace le manifeste par un rapport, un flux ou une requête,
+// ou "" si l'analyse produit un manifeste.
+func (o *Options) reportMode() string {
+	switch {
+	case o.BatchDiff != "":
+		return "-batch-diff"
+	case o.Query != "":
+		return "-query"
+	case o.LineRangeFile != "":
+		return "-file/-line-range"
+	case o.NDJSON:
+		return "-ndjson"
+	case o.SpillDir != "":
+		return "-spill-dir"
+	case o.DryRun:
+		return "-dry-run"
+	case o.CheckIDs:
+		return "-check-ids"
+	case o.DetectImportCycles:
+		return "-detect-import-cycles"
+	case o.GroupByMethodName:
+		return "-group-by-method-name"
+	case o.FindSimilar > 0:
+		return "-find-similar"
+	case o.FindDuplicates:
+		return "-find-duplicates"
+	}
+	return ""
+}
+
+// ParseProject analyse le projet Go sous root et retourne son manifeste, celui que la ligne de
+// commande écrit en JSON. Les options qui remplacent le manifeste par un rapport, un flux ou
+// une requête (cf. reportMode) relèvent de Run, comme le format de sortie.
+func ParseProject(root string, opts Options) (FragmentManifest, error) {
+	if err := opts.normalize(); err != nil {
+		return FragmentManifest{}, err
+	}
+	if mode := opts.reportMode(); mode != "" {
+		return FragmentManifest{}, fmt.Errorf("%s ne produit pas de manifeste (utiliser Run)", mode)
+	}
+	a, err := analyze(root, nil, &opts, nil)
+	if err != nil {
+		return FragmentManifest{}, err
+	}
+	return a.manifest, nil
+}
+
+// ParseStream analyse le projet Go sous root comme ParseProject, mais envoie chaque fragment sur
+// le premier canal dès la fusion de son fichier, dans l'ordre du parcours, au lieu d'attendre le
+// manifeste complet. Le second canal reçoit au plus une erreur: celle de l'analyse, ou
+// ctx.Err() si ctx est annulé, ce qui arrête le parcours. Les deux canaux sont fermés à la fin
+// de l'analyse; le canal d'erreur, tamponné, ne retarde jamais les fragments. Comme -ndjson,
+// le flux exclut les options qui ont besoin du manifeste entier.
+func ParseStream(ctx context.Context, root string, opts Options) (<-chan FragmentInfo, <-chan error) {
+	fragments := make(chan FragmentInfo)
+	errc := make(chan error, 1)
+	fail := func(err error) (<-chan FragmentInfo, <-chan error) {
+		errc <- err
+		close(fragments)
+		close(errc)
+		return fragments, errc
+	}
+	if err := opts.normalize(); err != nil {
+		return fail(err)
+	}
+	if mode := opts.reportMode(); mode != "" {
+		return fail(fmt.Errorf("%s ne produit pas de manifeste (utiliser Run)", mode))
+	}
+	if conflicts := opts.wholeManifestOptions(); len(conflicts) > 0 {
+		return fail(fmt.Errorf("ParseStream incompatible avec %s (passes sur le manifeste entier)", strings.Join(conflicts, ", ")))
+	}
+	if opts.BasePath != "" {
+		return fail(fmt.Errorf("ParseStream incompatible avec -base"))
+	}
+	a, err := newAnalyzer(root, nil, &opts, nil)
+	if err != nil {
+		return fail(err)
+	}
+	a.ctx, a.stream = ctx, fragments
+	go func() {
+		defer close(errc)
+		defer close(fragments)
+		if err := a.run(); err != nil {
+			errc <- err
+			return
+		}
+		if opts.ExportedOnly {
+			a.logger.Printf("-exported-only: %d fragment(s) non exporté(s) écarté(s).\n", a.filteredUnexported)
+		}
+	}()
+	return fragments, errc
+}
+
+// sourcesRoot est la racine virtuelle sous laquelle ParseFS monte son système de fichiers:
+// elle n'apparaît que dans les journaux, les chemins émis restant relatifs à la racine.
+var sourcesRoot = filepath.FromSlash("/sources")
+
+// ParseFS analyse le projet Go à la racine de fsys, comme ParseProject sur le disque: go.mod,
+// .gitignore, directives replace et sources .templ sont cherchés dans fsys. Les options qui
+// ont besoin du disque ou d'outils externes (-type-check et ce qui l'implique, -dirty-only)
+// sont refusées.
+func ParseFS(fsys fs.FS, opts Options) (FragmentManifest, error) {
+	if err := opts.normalize(); err != nil {
+		return FragmentManifest{}, err
+	}
+	if mode := opts.reportMode(); mode != "" {
+		return FragmentManifest{}, fmt.Errorf("%s ne produit pas de manifeste (utiliser Run)", mode)
+	}
+	if opts.needsTypeCheck() {
+		return FragmentManifest{}, fmt.Errorf("-type-check, -check-alignment et -resolve-const-values chargent les paquets depuis le disque: indisponibles sur un fs.FS")
+	}
+	if opts.DirtyOnly {
+		return FragmentManifest{}, fmt.Errorf("-dirty-only interroge git: indisponible sur un fs.FS")
+	}
+	a, err := analyze(sourcesRoot, &sourceFS{fsys: fsys, root: sourcesRoot}, &opts, nil)
+	if err != nil {
+		return FragmentManifest{}, err
+	}
+	return a.manifest, nil
+}
+
+// ParseSources analyse des sources en mémoire: les clés sont des chemins à barres obliques
+// relatifs à une racine virtuelle ("go.mod", "pkg/a.go", "views/page.templ"...), avec les mêmes
+// règles que ParseFS.
+func ParseSources(sources map[string][]byte, opts Options) (FragmentManifest, error) {
+	fsys := make(fstest.MapFS, len(sources))
+	for name, data := range sources {
+		name = path.Clean(strings.TrimPrefix(name, "./"))
+		if !fs.ValidPath(name) || name == "." {
+			return FragmentManifest{}, fmt.Errorf("chemin de source invalide %q (relatif, à barres obliques, sans ..)", name)
+		}
+		fsys[name] = &fstest.MapFile{Data: data, Mode: 0o644}
+	}
+	return ParseFS(fsys, opts)
+}
+
+// Run exécute ce que la ligne de commande demande: requête sur un manifeste existant, rapport,
+// ou manifeste du projet rootDir écrit sur out dans opts.Format.
+func Run(rootDir string, opts Options, out io.Writer) error {
+	if err := opts.normalize(); err != nil {
+		return err
+	}
+	logger := opts.logger()
+	if opts.BatchDiff != "" {
+		if err := runBatchDiff(opts.BatchDiff, out); err != nil {
+			return fmt.Errorf("-batch-diff: %w", err)
+		}
+		return nil
+	}
+	if opts.LineRangeFile != "" && opts.ManifestPath != "" {
+		manifest, err := loadManifest(opts.ManifestPath)
+		if err != nil {
+			return fmt.Errorf("-line-range: %w", err)
+		}
+		return printJSON(out, fragmentsInLineRange(manifest.Fragments, opts.LineRangeFile, opts.LineStart, opts.LineEnd))
+	}
+	if opts.Query != "" {
+		// rootDir est ici l'argument de la requête (ID de fragment ou nom de type).
+		if err := runQuery(opts.Query, rootDir, opts.ManifestPath, out); err != nil {
+			return fmt.Errorf("-query: %w", err)
+		}
+		return nil
+	}
+	a, err := analyze(rootDir, nil, &opts, out)
+	if err != nil {
+		return err
+	}
+	manifest := a.manifest
+
+	if opts.CheckIDs {
+		collisions := idCollisions(a.idClaims)
+		logger.Printf("%d ID(s) de fragment en collision.\n", len(collisions))
+		if err := printJSON(out, map[string][]IDCollision{"id_collisions": collisions}); err != nil {
+			return err
+		}
+		if len(collisions) > 0 {
+			return ErrChecksFailed
+		}
+		return nil
+	}
+
+	if opts.DetectImportCycles {
+		cycles := importCycles(a.packageImports)
+		logger.Printf("%d cycle(s) d'imports entre %d paquet(s).\n", len(cycles), len(a.packageImports))
+		if err := printJSON(out, map[string][][]string{"import_cycles": cycles}); err != nil {
+			return err
+		}
+		if opts.FailOnCycle && len(cycles) > 0 {
+			return ErrChecksFailed
+		}
+		return nil
+	}
+
+	if a.dryRun != nil {
+		logger.Printf("Dry-run: %d fichier(s) seraient analysés, %d ignoré(s).\n", len(a.dryRun.Files), len(a.dryRun.Skipped))
+		return printJSON(out, a.dryRun)
+	}
+
+	if opts.NDJSON {
+		logger.Printf("Analyse terminée. %d fragment(s) émis en NDJSON.\n", a.ndjsonCount)
+		return nil
+	}
+
+	if spill := a.spill; spill != nil {
+		defer spill.cleanup()
+		if err := spill.flush(manifest.Fragments); err != nil {
+			return fmt.Errorf("déversement dans %q: %w", opts.SpillDir, err)
+		}
+		logger.Printf("Fin parcours. %d fragments en %d lot(s). Fusion JSON...\n", len(spill.lastChunk), len(spill.files))
+		entrypoints, err := spill.index()
+		if err != nil {
+			return fmt.Errorf("relecture des fragments déversés: %w", err)
+		}
+		manifest.Entrypoints = entrypoints
+		if err := spill.emit(out, manifest); err != nil {
+			return fmt.Errorf("fusion des fragments déversés: %w", err)
+		}
+		logger.Printf("Analyse terminée. Manifeste JSON généré.\n")
+		return nil
+	}
+
+	if opts.LineRangeFile != "" {
+		file := opts.LineRangeFile
+		if filepath.IsAbs(file) {
+			if rel, err := filepath.Rel(a.absRootDir, file); err == nil {
+				file = rel
+			}
+		}
+		result := fragmentsInLineRange(manifest.Fragments, file, opts.LineStart, opts.LineEnd)
+		logger.Printf("%d fragment(s) dans %s.\n", len(result.Results), result.Target)
+		return printJSON(out, result)
+	}
+
+	if opts.GroupByMethodName {
+		groups := groupMethodsByName(manifest.Fragments)
+		logger.Printf("%d nom(s) de méthode distinct(s).\n", len(groups))
+		return printJSON(out, map[string]map[string][]MethodGroupEntry{"methods": groups})
+	}
+
+	if opts.FindSimilar > 0 {
+		clusters := findSimilar(manifest.Fragments, opts.FindSimilar)
+		logger.Printf("%d groupe(s) de fragments similaires (seuil %.2f).\n", len(clusters), opts.FindSimilar)
+		return printJSON(out, map[string][]SimilarCluster{"similar": clusters})
+	}
+
+	if opts.FindDuplicates {
+		clusters := findDuplicates(manifest.Fragments)
+		logger.Printf("%d groupe(s) de fragments dupliqués.\n", len(clusters))
+		return printJSON(out, map[string][]DuplicateCluster{"duplicates": clusters})
+	}
+
+	switch opts.Format {
+	case "ctags":
+		logger.Printf("Fin parcours. %d fragments. Écriture des tags ctags...\n", len(manifest.Fragments))
+		if err := writeCtags(out, manifest.Fragments); err != nil {
+			return fmt.Errorf("écriture ctags: %w", err)
+		}
+		logger.Printf("Analyse terminée. Fichier tags généré.\n")
+	case "lsif":
+		logger.Printf("Fin parcours. %d fragments. Écriture du dump LSIF...\n", len(manifest.Fragments))
+		if err := writeLSIF(out, manifest.Fragments, a.absRootDir); err != nil {
+			return fmt.Errorf("écriture LSIF: %w", err)
+		}
+		logger.Printf("Analyse terminée. Dump LSIF généré.\n")
+	case "json-array":
+		logger.Printf("Fin parcours. %d fragments. Marshalling JSON (tableau)...\n", len(manifest.Fragments))
+		if err := printJSON(out, fragmentArrayManifest{FragmentManifest: manifest, Fragments: sortedFragmentEntries(manifest.Fragments)}); err != nil {
+			return err
+		}
+		logger.Printf("Analyse terminée. Manifeste JSON généré.\n")
+	case "yaml":
+		logger.Printf("Fin parcours. %d fragments. Écriture YAML...\n", len(manifest.Fragments))
+		if err := writeYAML(out, manifest); err != nil {
+			return fmt.Errorf("écriture YAML: %w", err)
+		}
+		logger.Printf("Analyse terminée. Manifeste YAML généré.\n")
+	case "github-annotations":
+		count, err := writeGitHubAnnotations(out, manifest, opts.MinDocCoverage > 0)
+		if err != nil {
+			return fmt.Errorf("écriture annotations: %w", err)
+		}
+		logger.Printf("Analyse terminée. %d annotation(s) GitHub émise(s).\n", count)
+	case "html":
+		logger.Printf("Fin parcours. %d fragments. Écriture du rapport HTML...\n", len(manifest.Fragments))
+		if err := writeHTML(out, manifest, a.absRootDir); err != nil {
+			return fmt.Errorf("écriture HTML: %w", err)
+		}
+		logger.Printf("Analyse terminée. Rapport HTML généré.\n")
+	default:
+		logger.Printf("Fin parcours. %d fragments. Marshalling JSON...\n", len(manifest.Fragments))
+		if err := printJSON(out, manifest); err != nil {
+			return err
+		}
+		logger.Printf("Analyse terminée. Manifeste JSON généré.\n")
+	}
+
+	if a.checksFailed {
+		return ErrChecksFailed
+	}
+	return nil
+}
+
+// analyzer porte l'état d'une analyse: les options, le manifeste en construction et les données
+// des modes de Run qui le remplacent par un rapport ou un flux, ainsi que l'état du parcours.
+// Le parcours (walk), séquentiel, émet les fichiers dans l'ordre; un pool de workers les
+// traite (processFile); une seule goroutine les fusionne dans cet ordre (mergeFile); les passes
+// sur le manifeste entier (postPasses) suivent. Chaque étape est une méthode testable seule.
+type analyzer struct {
+	opts       *Options
+	logger     Logger
+	out        io.Writer // Sortie en flux (-ndjson)
+	absRootDir string
+	fset       *token.FileSet
+
+	manifest       FragmentManifest
+	baseline       FragmentManifest           // -changed-packages-only
+	base           *incrementalBase           // Non nil uniquement avec -base
+	declIDs        map[*ast.Ident]string      // Identifiant déclarant -> ID de son fragment (passes go/types)
+	parsedFiles    []parsedFile               // Fichiers fusionnés, pour la vérification de types
+	dryRun         *DryRunReport              // -dry-run
+	idClaims       map[string][]IDClaim       // -check-ids
+	packageImports map[string]map[string]bool // Chemin d'import -> chemins importés (-detect-import-cycles)
+	spill          *fragmentSpill             // -spill-dir
+	ndjsonCount    int                        // Fragments écrits (-ndjson)
+	checksFailed   bool                       // -fail-on-long-func, -min-doc-coverage
+
+	generateDirectives map[string][]goGenerateDirective // Dossier (OriginalPath) -> directives (-link-generated)
+	generatedFiles     map[string]bool                  // OriginalPath des fichiers à en-tête de code généré
+	filteredUnexported int                              // Fragments écartés par -exported-only
+	idClaimsByBase     idBaseClaims                     // Bases d'ID des fichiers homonymes (cf. scanIDBaseClaims)
+	src                sourceFS                         // Sources lues: le disque, ou le fs.FS de ParseFS
+	mergeErr           error                            // Première erreur d'écriture de la fusion (-ndjson, -spill-dir, ParseStream)
+	ctx                context.Context                  // Annule le parcours et l'envoi sur stream (ParseStream)
+	stream             chan<- FragmentInfo              // Non nil sous ParseStream: reçoit les fragments à la fusion
+
+	walkRoots            []localReplace    // Module racine puis cibles locales des directives replace
+	replaceDirs          map[string]bool   // Dossiers des modules remplacés, parcourus à part
+	rootModulePath       string            // Module du go.mod racine
+	currentRoot          localReplace      // Module en cours de parcours
+	perIterationLoopVars bool              // go >= 1.22 dans le go.mod du module parcouru
+	dirtyFiles           map[string]bool   // Non nil uniquement avec -dirty-only
+	gitignore            *gitignoreMatcher // Non nil avec -respect-gitignore et un .gitignore racine
+	jobs                 chan *fileJob     // Fichiers à traiter par les workers
+	pending              chan *fileJob     // Mêmes fichiers, dans l'ordre de fusion
+	// scanFile, non nil pendant le pré-parcours des bases d'ID (cf. scanIDBaseClaims), reçoit
+	// les fichiers que le parcours analyserait: rien n'est alors lu, signalé ni mis en file.
+	scanFile func(path, relPath string)
+}
+
+// analyze parcourt le projet rootDir et construit son manifeste. Avec -ndjson, les fragments
+// sont écrits sur out au fil du parcours; les modes rapport de Run (-check-ids, -dry-run,
+// -detect-import-cycles, -spill-dir...) s'arrêtent après le parcours, sans les passes sur le
+// manifeste entier.
+func analyze(rootDir string, src *sourceFS, opts *Options, out io.Writer) (*analyzer, error) {
+	a, err := newAnalyzer(rootDir, src, opts, out)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.run(); err != nil {
+		if a.spill != nil {
+			a.spill.cleanup()
+		}
+		return nil, err
+	}
+	if opts.ExportedOnly {
+		a.logger.Printf("-exported-only: %d fragment(s) non exporté(s) écarté(s).\n", a.filteredUnexported)
+	}
+	if a.base != nil {
+		a.reparseStale()
+	}
+	if opts.CheckIDs || opts.DetectImportCycles || a.dryRun != nil || opts.NDJSON || a.spill != nil {
+		// Rapports et flux de Run: les passes sur le manifeste entier ne s'appliquent pas.
+		return a, nil
+	}
+	a.postPasses()
+	return a, nil
+}
+
+// newAnalyzer prépare l'analyse de rootDir: manifestes de référence (-baseline, -base),
+// manifeste vide, modules à parcourir et filtres du parcours (-dirty-only, -respect-gitignore).
+// Les sources sont lues dans src, monté sur rootDir, ou sur le disque si src est nil.
+func newAnalyzer(rootDir string, src *sourceFS, opts *Options, out io.Writer) (*analyzer, error) {
+	a := &analyzer{
+		ctx:                context.Background(),
+		opts:               opts,
+		logger:             opts.logger(),
+		out:                out,
+		fset:               token.NewFileSet(),
+		declIDs:            make(map[*ast.Ident]string),
+		packageImports:     make(map[string]map[string]bool),
+		generateDirectives: make(map[string][]goGenerateDirective),
+		generatedFiles:     make(map[string]bool),
+		idClaimsByBase:     make(idBaseClaims),
+	}
+	var err error
+	if opts.ChangedPackagesOnly {
+		if a.baseline, err = loadManifest(opts.BaselinePath); err != nil {
+			return nil, fmt.Errorf("-baseline: %w", err)
+		}
+	}
+	if opts.BasePath != "" {
+		baseManifest, err := loadManifest(opts.BasePath)
+		if err != nil {
+			return nil, fmt.Errorf("-base: %w", err)
+		}
+		if baseManifest.FileDigests == nil {
+			return nil, fmt.Errorf("-base: %s a été généré sans -file-digests", opts.BasePath)
+		}
+		if opts.Digest != "sha1" && baseManifest.DigestAlgorithm != opts.Digest || opts.Digest == "sha1" && baseManifest.DigestAlgorithm != "" {
+			return nil, fmt.Errorf("-base: digests %q, différents de -digest %s", baseManifest.DigestAlgorithm, opts.Digest)
+		}
+		a.base = newIncrementalBase(baseManifest)
+	}
+	if src != nil {
+		a.src, a.absRootDir = *src, src.root
+	} else if a.absRootDir, err = filepath.Abs(rootDir); err != nil {
+		return nil, fmt.Errorf("résolution chemin absolu pour %q échouée: %w", rootDir, err)
+	} else {
+		a.src = diskSource(a.absRootDir)
+	}
+	if opts.BuildContext != nil {
+		// Les contraintes de build se lisent dans les mêmes sources que le parcours.
+		ctxt := *opts.BuildContext
+		ctxt.OpenFile = func(p string) (io.ReadCloser, error) { return a.src.open(p) }
+		opts.BuildContext = &ctxt
+	}
+
+	if opts.StripPrefix != "" && filepath.IsAbs(opts.StripPrefix) {
+		// Les chemins émis sont relatifs à la racine: un préfixe absolu est ramené à cette base.
+		opts.StripPrefix = relativeSlashPath(a.absRootDir, opts.StripPrefix)
+	}
+	opts.StripPrefix = strings.Trim(path.Clean(filepath.ToSlash(opts.StripPrefix)), "/")
+
+	a.manifest = FragmentManifest{SchemaVersion: manifestSchemaVersion, Fragments: make(map[string]FragmentInfo)}
+	if opts.Digest != "sha1" {
+		a.manifest.DigestAlgorithm = opts.Digest
+	}
+	if opts.RecordMtimes {
+		a.manifest.FileModTimes = make(map[string]string)
+	}
+	if opts.RecordHeaders {
+		a.manifest.FileHeaders = make(map[string]string)
+	}
+	if opts.EmitFileStats {
+		a.manifest.FileStats = make(map[string]FileStat)
+	}
+	if opts.FileDigests {
+		a.manifest.FileDigests = make(map[string]FileDigest)
+	}
+	if opts.CheckIDs {
+		a.idClaims = make(map[string][]IDClaim)
+	}
+	if opts.SpillDir != "" {
+		if err := os.MkdirAll(opts.SpillDir, 0o755); err != nil {
+			return nil, fmt.Errorf("création -spill-dir %q: %w", opts.SpillDir, err)
+		}
+		a.spill = &fragmentSpill{dir: opts.SpillDir, byPath: opts.Format == "json-array", lastChunk: make(map[string]int)}
+	}
+
+	if opts.DryRun {
+		a.dryRun = &DryRunReport{Files: []string{}, Skipped: []SkippedPath{}}
+	}
+
+	a.logger.Printf("Analyse du projet Go dans: %s\n", a.absRootDir)
+
+	// Le module racine est parcouru en premier, puis les cibles locales des directives replace.
+	a.walkRoots = []localReplace{{dirAbs: a.absRootDir}}
+	a.replaceDirs = make(map[string]bool)
+	if opts.FollowReplaces {
+		for _, r := range readLocalReplaces(a.src, a.absRootDir, a.logger) {
+			if a.replaceDirs[r.dirAbs] || r.dirAbs == a.absRootDir {
+				continue
+			}
+			a.replaceDirs[r.dirAbs] = true
+			a.walkRoots = append(a.walkRoots, r)
+		}
+	}
+	if opts.DirtyOnly {
+		a.dirtyFiles, err = gitDirtyGoFiles(a.absRootDir)
+		if err != nil {
+			return nil, fmt.Errorf("-dirty-only: %w", err)
+		}
+		a.logger.Printf("-dirty-only: %d fichier(s) .go modifié(s) dans le dépôt.\n", len(a.dirtyFiles))
+	}
+	// Avec -respect-gitignore et un .gitignore racine, ses règles remplacent les exclusions
+	// par défaut et celle des dossiers cachés (seul .git reste exclu d'office); -exclude-dir et
+	// -include-dir-override s'appliquent toujours.
+	if opts.RespectGitignore {
+		if _, err := a.src.stat(filepath.Join(a.absRootDir, ".gitignore")); err == nil {
+			a.gitignore = &gitignoreMatcher{}
+			excluded := make(map[string]string, len(opts.DirSkips.Excluded))
+			for name, reason := range opts.DirSkips.Excluded {
+				excluded[name] = reason
+			}
+			opts.DirSkips.Excluded = excluded
+			for name, reason := range defaultSkippedDirs {
+				if opts.DirSkips.Excluded[name] == reason {
+					delete(opts.DirSkips.Excluded, name)
+				}
+			}
+			opts.DirSkips.SkipHidden = false
+		} else {
+			a.logger.Printf("-respect-gitignore: pas de .gitignore dans %s, exclusions par défaut conservées.\n", a.absRootDir)
+		}
+	}
+	a.rootModulePath = readModulePath(a.src, a.absRootDir)
+	if opts.MarkInternalImports && a.rootModulePath == "" {
+		a.logger.Printf("Avertissement: -mark-internal-imports sans go.mod racine: aucun import marqué interne.\n")
+	}
+	return a, nil
+}
+
+// currentModule retourne le module du parcours en cours (racine ou remplacé).
+func (a *analyzer) currentModule() string {
+	if a.currentRoot.modulePath != "" {
+		return a.currentRoot.modulePath
+	}
+	return a.rootModulePath
+}
+
+// importPathOf dérive le chemin d'import du dossier d'un fichier du module en cours de parcours.
+func (a *analyzer) importPathOf(filePath string) string {
+	return importPathForDir(a.currentModule(), relativeSlashPath(a.currentRoot.dirAbs, filepath.Dir(filePath)))
+}
+
+// processFile lit, parse et visite un fichier découvert par le parcours. Appelé par les
+// workers (-j): il n'écrit que dans son résultat, fusionné ensuite par mergeFile.
+func (a *analyzer) processFile(job *fileJob) {
+	result := &job.result
+	path := job.path
+	if a.opts.BuildContext != nil {
+		match, err := a.opts.BuildContext.MatchFile(filepath.Dir(path), filepath.Base(path))
+		if err != nil {
+			a.logger.Printf("Avertissement: Contraintes de build illisibles dans %q: %v\n", job.relPath, err)
+		} else if !match {
+			result.skipPath, result.skipReason = job.relPath, "contraintes de build non satisfaites (-build-tags)"
+			return
+		}
+	}
+	if job.isTest {
+		// Les tests ne produisent pas de fragments: ils ne servent qu'à résoudre leurs appels.
+		content, err := a.src.readFile(path)
+		if err != nil {
+			a.logger.Printf("Avertissement: Échec lecture fichier de test %q: %v\n", job.relPath, err)
+			return
+		}
+		node, err := parser.ParseFile(a.fset, path, content, 0)
+		if err != nil {
+			a.logger.Printf("Avertissement: Échec parsing fichier de test %q: %v\n", job.relPath, err)
+			return
+		}
+		result.node = node
+		return
+	}
+	originalGoPathRel := job.relPath
+
+	// En dry-run, le contenu n'est lu que s'il faut détecter l'en-tête de code généré.
+	var contentBytes []byte
+	var err error
+	if !a.opts.DryRun || a.opts.ExcludeGenerated {
+		contentBytes, err = a.src.readFile(path)
+		if err != nil {
+			a.logger.Printf("Avertissement: Échec lecture fichier %q: %v\n", path, err)
+			result.skipPath, result.skipReason = originalGoPathRel, "lecture impossible"
+			return
+		}
+	}
+
+	generated := contentBytes != nil && isGeneratedSource(contentBytes)
+	if a.opts.ExcludeGenerated && generated {
+		a.logger.Printf("Ignoré fichier généré: %s\n", originalGoPathRel)
+		result.skipPath, result.skipReason = originalGoPathRel, "fichier généré (-exclude-generated)"
+		return
+	}
+
+	if a.opts.DryRun {
+		result.dryRunFile = true
+		return
+	}
+	if a.base != nil && !job.forceParse {
+		if digest, ok := a.base.manifest.FileDigests[originalGoPathRel]; ok && digest.Digest == a.opts.contentDigest(contentBytes) {
+			result.reused = true
+			result.digest = digest
+			result.header = a.base.manifest.FileHeaders[originalGoPathRel]
+			result.fragments = make(map[string]FragmentInfo)
+			for id, info := range a.base.fragmentsByFile[originalGoPathRel] {
+				info.importPath = job.importPath
+				if result.idBase == "" {
+					result.idBase = fragmentIDBaseFor(a.opts, info.PackageName, originalGoPathRel)
+				}
+				result.fragments[id] = info
+			}
+			// Les IDs repris portent le suffixe attribué par -base: il est recalculé à la fusion.
+			if suffixed := result.idBase + dirHashSuffix(filepath.ToSlash(filepath.Dir(originalGoPathRel))); result.idBase != "" && !a.opts.IDDirHash {
+				fragments := make(map[string]FragmentInfo, len(result.fragments))
+				for id, info := range result.fragments {
+					if strings.HasPrefix(id, suffixed+"_") {
+						id = result.idBase + id[len(suffixed):]
+						result.baseSuffixed = true
+					}
+					fragments[id] = info
+				}
+				result.fragments = fragments
+			}
+			return
+		}
+	}
+	a.logger.Printf("Parsing du fichier Go: %s\n", originalGoPathRel)
+
+	node, err := parser.ParseFile(a.fset, path, contentBytes, parser.ParseComments)
+	if err != nil {
+		a.logger.Printf("Avertissement: Échec parsing fichier %q: %v\n", originalGoPathRel, err)
+		return
+	}
+	result.node = node
+	if a.opts.RecordHeaders {
+		result.header = fileHeaderComment(node)
+	}
+	if a.opts.FileDigests {
+		result.digest = a.opts.fileDigest(contentBytes)
+	}
+	if a.opts.LinkGenerated {
+		result.directives = goGenerateDirectives(a.fset, node, originalGoPathRel)
+	}
+	result.generated = generated
+	if a.opts.EmitFileStats {
+		result.stat = FileStat{
+			Lines: a.fset.File(node.Pos()).LineCount(),
+			Bytes: job.fileinfo.Size(),
+		}
+	}
+
+	// Déterminer si c'est un fichier _templ.go et trouver son source .templ
+	var actualSrcPathRel string
+	var isTemplSrc bool
+	if strings.HasSuffix(originalGoPathRel, "_templ.go") {
+		// path est le chemin absolu du fichier _templ.go
+		templSrc, found := findTemplSourcePath(a.src, path, a.absRootDir, a.logger)
+		if found {
+			actualSrcPathRel = stripPathPrefix(templSrc, a.opts.StripPrefix)
+			isTemplSrc = true
+			a.logger.Printf("  -> Fichier source .templ identifié: %s\n", actualSrcPathRel)
+		} else {
+			actualSrcPathRel = originalGoPathRel // Fallback sur le _templ.go
+			isTemplSrc = false
+			a.logger.Printf("  -> Fichier source .templ non trouvé pour %s, utilisation de _templ.go lui-même.\n", originalGoPathRel)
+		}
+	} else {
+		actualSrcPathRel = originalGoPathRel
+		isTemplSrc = false
+	}
+
+	result.imports = extractImports(node)
+	if a.opts.MarkInternalImports {
+		markInternalImports(result.imports, job.modulePath)
+	}
+	result.fragments = make(map[string]FragmentInfo)
+	result.declIDs = make(map[*ast.Ident]string)
+	if a.opts.CheckIDs {
+		result.idClaims = make(map[string][]IDClaim)
+	}
+	v := &visitor{
+		fset:                        a.fset,
+		fragments:                   result.fragments,
+		currentOriginalPathRel:      originalGoPathRel, // Toujours le .go
+		currentActualSourcePathRel:  actualSrcPathRel,  // Le .templ ou le .go
+		currentIsTemplSource:        isTemplSrc,
+		currentPackageName:          node.Name.Name,
+		currentFileImports:          result.imports,
+		projectRootDirAbs:           a.absRootDir,
+		opts:                        a.opts,
+		declIDs:                     result.declIDs,
+		currentModulePath:           job.replacedModule,
+		currentImportPath:           job.importPath,
+		currentDeprecatedByTag:      len(a.opts.DeprecatedTags) > 0 && requiresAnyBuildTag(node, a.opts.DeprecatedTags),
+		currentPerIterationLoopVars: job.perIterationLoopVars,
+		currentIsTestFile:           job.testFragments,
+		currentIsTestExportFile:     job.testFragments && isTestExportFile(job.relPath),
+		currentIsGenerated:          generated,
+		idClaims:                    result.idClaims,
+	}
+	if a.opts.CommentDensity {
+		v.currentCommentLines = commentLines(a.fset, node)
+	}
+	ast.Walk(v, node)
+	result.filteredUnexported = v.filteredUnexported
+	result.idBase = v.fragmentIDBase()
+}
+
+// mergeFile intègre le résultat d'un fichier au manifeste. Les fichiers sont fusionnés dans
+// l'ordre du parcours, quel que soit l'ordre de fin des workers: entre deux fragments de même
+// ID, le dernier parcouru l'emporte, comme en séquentiel.
+func (a *analyzer) mergeFile(job *fileJob) {
+	if a.mergeErr != nil {
+		return
+	}
+	result := &job.result
+	if result.skipReason != "" {
+		a.dryRun.skip(result.skipPath, result.skipReason)
+		return
+	}
+	if result.dryRunFile {
+		a.dryRun.Files = append(a.dryRun.Files, job.relPath)
+		return
+	}
+	if result.node == nil && !result.reused {
+		return
+	}
+	if job.isTest {
+		a.parsedFiles = append(a.parsedFiles, parsedFile{relPath: job.relPath, node: result.node, importPath: job.importPath, isTest: true})
+		return
+	}
+	originalGoPathRel := job.relPath
+	if a.opts.RecordMtimes {
+		a.manifest.FileModTimes[originalGoPathRel] = job.fileinfo.ModTime().Format(time.RFC3339)
+	}
+	if a.opts.RecordHeaders {
+		a.manifest.FileHeaders[originalGoPathRel] = result.header
+	}
+	if a.opts.FileDigests {
+		a.manifest.FileDigests[originalGoPathRel] = result.digest
+	}
+	if a.opts.LinkGenerated {
+		dir := filepath.ToSlash(filepath.Dir(originalGoPathRel))
+		a.generateDirectives[dir] = append(a.generateDirectives[dir], result.directives...)
+		if result.generated {
+			a.generatedFiles[originalGoPathRel] = true
+		}
+	}
+	if a.opts.EmitFileStats {
+		a.manifest.FileStats[originalGoPathRel] = result.stat
+	}
+	if a.opts.DetectImportCycles {
+		if a.packageImports[job.importPath] == nil {
+			a.packageImports[job.importPath] = make(map[string]bool)
+		}
+		for _, imp := range result.imports {
+			a.packageImports[job.importPath][imp.Path] = true
+		}
+	}
+	if result.idBase != "" {
+		suffix := a.idClaimsByBase.suffix(result.idBase, path.Dir(job.relPath))
+		if suffix != "" {
+			a.logger.Printf("Avertissement: %s produit les mêmes IDs qu'un fichier de %s: suffixe %s ajouté.\n",
+				job.relPath, a.idClaimsByBase[result.idBase], suffix)
+			rekeyFileResult(result, result.idBase, suffix)
+		}
+		if result.reused && result.baseSuffixed != (suffix != "") {
+			// Les références vers ces IDs, dans tous les paquets, datent de -base.
+			a.base.idsChanged = true
+		}
+	}
+	a.filteredUnexported += result.filteredUnexported
+	if a.stream != nil {
+		for _, entry := range sortedFragmentEntries(result.fragments) {
+			if err := a.ctx.Err(); err != nil {
+				// Consommateur et annulation prêts ensemble: l'annulation l'emporte.
+				a.mergeErr = err
+				return
+			}
+			select {
+			case a.stream <- entry.FragmentInfo:
+			case <-a.ctx.Done():
+				a.mergeErr = a.ctx.Err()
+				return
+			}
+		}
+		return
+	}
+	if a.opts.NDJSON {
+		if err := writeNDJSON(a.out, sortedFragmentEntries(result.fragments)); err != nil {
+			a.mergeErr = err
+			return
+		}
+		a.ndjsonCount += len(result.fragments)
+		return
+	}
+	for id, info := range result.fragments {
+		a.manifest.Fragments[id] = info
+	}
+	if a.base != nil {
+		a.base.record(job)
+	}
+	for ident, id := range result.declIDs {
+		a.declIDs[ident] = id
+	}
+	for id, claims := range result.idClaims {
+		a.idClaims[id] = append(a.idClaims[id], claims...)
+	}
+
+	if a.opts.needsTypeCheck() {
+		a.parsedFiles = append(a.parsedFiles, parsedFile{relPath: originalGoPathRel, node: result.node, importPath: job.importPath, isTest: job.testFragments})
+	}
+	if a.spill != nil && len(a.manifest.Fragments) >= a.opts.SpillThreshold {
+		if err := a.spill.flush(a.manifest.Fragments); err != nil {
+			a.mergeErr = fmt.Errorf("déversement dans %q: %w", a.opts.SpillDir, err)
+			return
+		}
+		// Les identifiants retiennent les AST des fichiers; aucune passe ne s'en sert avec -spill-dir.
+		for ident := range a.declIDs {
+			delete(a.declIDs, ident)
+		}
+	}
+}
+
+// run exécute le parcours en pipeline: le parcours (séquentiel) émet les fichiers dans l'ordre;
+// opts.Jobs workers les traitent; la fusion attend chaque fichier dans l'ordre d'émission. La
+// capacité de pending borne le nombre de fichiers parsés en attente de fusion. Retourne
+// l'erreur du parcours ou, à défaut, de la fusion.
+func (a *analyzer) run() error {
+	a.jobs = make(chan *fileJob)
+	a.pending = make(chan *fileJob, 4*a.opts.Jobs)
+	for w := 0; w < a.opts.Jobs; w++ {
+		go a.work()
+	}
+	merged := make(chan struct{})
+	go func() {
+		a.merge()
+		close(merged)
+	}()
+	walkErr := a.walk()
+	close(a.jobs)
+	close(a.pending)
+	<-merged
+	if walkErr != nil {
+		return walkErr
+	}
+	return a.mergeErr
+}
+
+// work est un worker du pool: il traite les fichiers de jobs jusqu'à sa fermeture.
+func (a *analyzer) work() {
+	for job := range a.jobs {
+		a.processFile(job)
+		close(job.done)
+	}
+}
+
+// merge fusionne les fichiers de pending dans l'ordre du parcours. La fusion est le seul
+// écrivain de la sortie en flux (-ndjson) et du manifeste: les workers ne lui transmettent
+// leurs résultats que par pending.
+func (a *analyzer) merge() {
+	for job := range a.pending {
+		<-job.done
+		a.mergeFile(job)
+	}
+}
+
+// skip transmet une exclusion décidée pendant le parcours, à sa place dans l'ordre de fusion.
+func (a *analyzer) skip(relPath, reason string) {
+	if a.scanFile != nil {
+		return
+	}
+	job := &fileJob{done: make(chan struct{}), result: fileResult{skipPath: relPath, skipReason: reason}}
+	close(job.done)
+	a.pending <- job
+}
+
+// walkFile est la fonction de parcours (filepath.WalkFunc): elle applique les exclusions de
+// dossiers et de fichiers et met chaque .go retenu en file, ou le transmet à scanFile.
+func (a *analyzer) walkFile(path string, fileinfo os.FileInfo, walkErr error) error {
+	if err := a.ctx.Err(); err != nil {
+		return err // Analyse annulée (ParseStream): rien de plus n'est mis en file.
+	}
+	if walkErr != nil {
+		if a.scanFile == nil {
+			a.logger.Printf("Avertissement: Erreur accès à %q: %v\n", path, walkErr)
+		}
+		return nil // Tenter de continuer
+	}
+
+	if fileinfo.IsDir() {
+		if a.replaceDirs[path] && path != a.currentRoot.dirAbs {
+			// Module de remplacement imbriqué: parcouru à part, avec son propre module_path.
+			return filepath.SkipDir
+		}
+		reason := a.opts.DirSkips.reason(fileinfo.Name(), relativeSlashPath(a.absRootDir, path))
+		if a.gitignore != nil && reason == "" {
+			if fileinfo.Name() == ".git" {
+				reason = "dossier exclu par défaut"
+			} else if path != a.currentRoot.dirAbs && a.gitignore.ignored(path, true) {
+				reason = "ignoré par .gitignore (-respect-gitignore)"
+			}
+		}
+		if reason != "" {
+			if a.scanFile == nil {
+				a.logger.Printf("Ignoré dossier: %s\n", path)
+			}
+			a.skip(relativeSlashPath(a.absRootDir, path)+"/", reason)
+			return filepath.SkipDir
+		}
+		if a.opts.MaxDepth >= 0 && path != a.currentRoot.dirAbs {
+			if rel := relativeSlashPath(a.currentRoot.dirAbs, path); strings.Count(rel, "/")+1 > a.opts.MaxDepth {
+				a.skip(relativeSlashPath(a.absRootDir, path)+"/", "profondeur maximale (-max-depth, -non-recursive)")
+				return filepath.SkipDir
+			}
+		}
+		if a.gitignore != nil {
+			if err := a.gitignore.load(a.src, path); err != nil {
+				a.logger.Printf("Avertissement: Échec lecture .gitignore dans %q: %v\n", path, err)
+			}
+		}
+		return nil
+	}
+
+	lowerPath := strings.ToLower(path)
+	// Ignorer les fichiers non-Go et les fichiers de test Go
+	if !strings.HasSuffix(lowerPath, ".go") {
+		return nil
+	}
+	if a.gitignore != nil && a.gitignore.ignored(path, false) {
+		a.skip(relativeSlashPath(a.absRootDir, path), "ignoré par .gitignore (-respect-gitignore)")
+		return nil
+	}
+	job := &fileJob{
+		path:                 path,
+		fileinfo:             fileinfo,
+		importPath:           a.importPathOf(path),
+		modulePath:           a.currentModule(),
+		replacedModule:       a.currentRoot.modulePath,
+		perIterationLoopVars: a.perIterationLoopVars,
+		done:                 make(chan struct{}),
+	}
+	if strings.HasSuffix(lowerPath, "_test.go") && !a.opts.IncludeTests {
+		if !a.opts.DetectUntested || a.opts.DryRun || a.scanFile != nil {
+			a.skip(relativeSlashPath(a.absRootDir, path), "fichier de test")
+			return nil
+		}
+		job.isTest = true
+		job.relPath = relativeSlashPath(a.absRootDir, path)
+		a.pending <- job
+		a.jobs <- job
+		return nil
+	}
+	if a.dirtyFiles != nil && !a.dirtyFiles[path] && a.scanFile == nil {
+		a.skip(relativeSlashPath(a.absRootDir, path), "non modifié (-dirty-only)")
+		return nil
+	}
+
+	job.testFragments = strings.HasSuffix(lowerPath, "_test.go")
+
+	// originalGoPathRel est le chemin relatif du fichier .go traité
+	originalGoPathRel, err := filepath.Rel(a.absRootDir, path)
+	if err != nil {
+		a.logger.Printf("Avertissement: Échec calcul chemin relatif pour %q: %v. Utilisation chemin complet.\n", path, err)
+		originalGoPathRel = path
+	}
+	job.relPath = stripPathPrefix(filepath.ToSlash(originalGoPathRel), a.opts.StripPrefix)
+	if a.scanFile != nil {
+		a.scanFile(path, job.relPath)
+		return nil
+	}
+	a.pending <- job
+	a.jobs <- job
+	return nil
+}
+
+// walkRootDirs parcourt le module racine puis les modules remplacés.
+func (a *analyzer) walkRootDirs() error {
+	for _, a.currentRoot = range a.walkRoots {
+		if a.currentRoot.modulePath != "" && a.scanFile == nil {
+			a.logger.Printf("Analyse du module remplacé %s dans: %s\n", a.currentRoot.modulePath, a.currentRoot.dirAbs)
+		}
+		a.perIterationLoopVars = goVersionAtLeast(readGoVersion(a.src, a.currentRoot.dirAbs), 1, 22)
+		// Le parcours visite les entrées de chaque dossier dans l'ordre lexical: l'ordre de
+		// fusion, et donc la sortie, est le même d'une exécution à l'autre.
+		if err := a.src.walk(a.currentRoot.dirAbs, a.walkFile); err != nil {
+			return fmt.Errorf("parcours répertoire %q: %w", a.currentRoot.dirAbs, err)
+		}
+	}
+	return nil
+}
+
+// walk pré-parcourt l'arbre pour départager les bases d'ID des fichiers homonymes, puis met en
+// file les fichiers à analyser: ceux de l'entrée standard (-stdin) ou ceux du parcours.
+func (a *analyzer) walk() error {
+	if !a.opts.IDDirHash && !a.opts.RootRelativeIDs && !a.opts.DryRun {
+		// Les fichiers homonymes sont départagés sur tout l'arbre, avant l'analyse: les IDs ne
+		// dépendent pas des fichiers retenus (-stdin, -dirty-only, -base). Ce pré-parcours ne
+		// lit que les noms, et l'en-tête des seuls fichiers homonymes (scanIDBaseClaims).
+		var scanned []scannedFile
+		a.scanFile = func(path, relPath string) {
+			scanned = append(scanned, scannedFile{path: path, relPath: relPath})
+		}
+		err := a.walkRootDirs()
+		a.scanFile = nil
+		if err != nil {
+			return err // Rien n'a été mis en file: le parcours n'est pas lancé.
+		}
+		if a.gitignore != nil {
+			a.gitignore = &gitignoreMatcher{} // Règles rechargées par le parcours
+		}
+		scanIDBaseClaims(a.src, a.idClaimsByBase, scanned, a.opts)
+	}
+	if a.opts.StdinFiles {
+		if err := a.readStdinFiles(); err != nil {
+			return fmt.Errorf("lecture de l'entrée standard (-stdin): %w", err)
+		}
+		return nil
+	}
+	return a.walkRootDirs()
+}
+
+// readStdinFiles met en file les fichiers .go listés sur l'entrée standard (-stdin), triés et
+// dédoublonnés, chacun avec le module (racine ou remplacé) le plus profond qui le contient.
+func (a *analyzer) readStdinFiles() error {
+	goVersions := make(map[string]bool) // Dossier du module -> go >= 1.22
+	type stdinFile struct {
+		path     string
+		fileinfo os.FileInfo
+	}
+	// Les chemins sont triés et dédoublonnés avant l'analyse : la sortie ne dépend pas de
+	// l'ordre dans lequel l'appelant les fournit.
+	var files []stdinFile
+	seen := make(map[string]bool)
+	var in io.Reader = os.Stdin
+	if a.opts.Stdin != nil {
+		in = a.opts.Stdin
+	}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		p := line
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(a.absRootDir, p)
+		}
+		p = filepath.Clean(p)
+		if rel := relativeSlashPath(a.absRootDir, p); rel == ".." || strings.HasPrefix(rel, "../") {
+			a.logger.Printf("Avertissement: Ignoré %q (-stdin): hors de la racine %s\n", line, a.absRootDir)
+			continue
+		}
+		fileinfo, err := a.src.stat(p)
+		if err != nil {
+			a.logger.Printf("Avertissement: Ignoré %q (-stdin): %v\n", line, err)
+			continue
+		}
+		if fileinfo.IsDir() || !strings.HasSuffix(strings.ToLower(p), ".go") {
+			a.logger.Printf("Avertissement: Ignoré %q (-stdin): pas un fichier .go\n", line)
+			continue
+		}
+		if !seen[p] {
+			seen[p] = true
+			files = append(files, stdinFile{path: p, fileinfo: fileinfo})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	for _, f := range files {
+		p := f.path
+		// Module (racine ou remplacé) le plus profond contenant le fichier, comme au parcours.
+		a.currentRoot = a.walkRoots[0]
+		for _, r := range a.walkRoots[1:] {
+			if strings.HasPrefix(p, r.dirAbs+string(filepath.Separator)) && len(r.dirAbs) > len(a.currentRoot.dirAbs) {
+				a.currentRoot = r
+			}
+		}
+		loopVars, ok := goVersions[a.currentRoot.dirAbs]
+		if !ok {
+			loopVars = goVersionAtLeast(readGoVersion(a.src, a.currentRoot.dirAbs), 1, 22)
+			goVersions[a.currentRoot.dirAbs] = loopVars
+		}
+		a.perIterationLoopVars = loopVars
+		if err := a.walkFile(p, f.fileinfo, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reparseStale reparse les fichiers inchangés d'un paquet modifié (-base): les passes
+// intra-paquet (types utilisés, méthodes effectives, ambiguïtés...) ont besoin de leurs
+// données internes.
+func (a *analyzer) reparseStale() {
+	reparse := a.base.staleReused()
+	for _, job := range reparse {
+		job.result = fileResult{}
+		job.forceParse = true
+		a.processFile(job)
+		if suffix := a.idClaimsByBase.suffix(job.result.idBase, path.Dir(job.relPath)); suffix != "" {
+			rekeyFileResult(&job.result, job.result.idBase, suffix)
+		}
+		for id, info := range job.result.fragments {
+			// L'ID reste à son dernier propriétaire dans l'ordre du parcours.
+			if current, ok := a.manifest.Fragments[id]; ok && current.OriginalPath == job.relPath {
+				a.manifest.Fragments[id] = info
+			}
+		}
+	}
+	a.logger.Printf("-base: %d fichier(s) réutilisé(s) sans parsing, %d analysé(s).\n", len(a.base.reused)-len(reparse), a.base.parsed+len(reparse))
+}
+
+// postPasses applique les passes sur le manifeste entier (appels, types utilisés,
+// vérification de types, agrégats par paquet, vérifications, enrichissement) et positionne
+// checksFailed.
+func (a *analyzer) postPasses() {
+	// Sous -type-check aussi: les paquets dont la vérification échoue partent de ces appels.
+	resolveCallsByName(a.manifest.Fragments)
+	if a.base != nil {
+		// Un fragment réutilisé garde ses appels de -base: ceux vers des fragments disparus sont retirés.
+		dropDanglingCalls(a.manifest.Fragments)
+	}
+	resolveTypesUsed(a.manifest.Fragments)
+	if a.opts.needsTypeCheck() {
+		a.logger.Printf("Vérification de types des paquets du projet...\n")
+		checkedPackages := typeCheckProject(a.fset, a.parsedFiles, a.absRootDir, a.opts.BuildContext, a.logger)
+		if a.opts.TypeCheck {
+			resolveCallsWithTypes(checkedPackages, a.declIDs, a.manifest.Fragments)
+		}
+		if a.opts.DetectUntested {
+			markTestedFragments(checkedPackages, a.parsedFiles, a.declIDs, a.manifest.Fragments)
+			untested := untestedExported(a.manifest.Fragments)
+			a.logger.Printf("%d fonction(s)/méthode(s) exportée(s) sans test.\n", len(untested))
+			for _, id := range untested {
+				info := a.manifest.Fragments[id]
+				a.logger.Printf("Sans test: %s (%s:%d)\n", id, info.OriginalPath, info.StartLine)
+			}
+		}
+		if a.opts.CheckAlignment {
+			checkStructAlignment(checkedPackages, a.declIDs, a.manifest.Fragments)
+		}
+		if a.opts.ResolveConstValues {
+			resolveConstValues(checkedPackages, a.declIDs, a.manifest.Fragments)
+		}
+	}
+	if a.opts.SplitCallEdges {
+		// Sur les appels résolus par noms, ou par go/types avec -type-check.
+		splitCallEdges(a.manifest.Fragments)
+	}
+	a.manifest.Entrypoints = collectEntrypoints(a.manifest.Fragments)
+	if a.opts.LinkGenerated {
+		linkGeneratedFragments(a.manifest.Fragments, a.generatedFiles, a.generateDirectives)
+	}
+	if a.opts.WithFileSymbols {
+		attachFileSymbols(a.manifest.Fragments)
+	}
+	if a.opts.EmitFileStats {
+		for _, info := range a.manifest.Fragments {
+			stat := a.manifest.FileStats[info.OriginalPath]
+			stat.Fragments++
+			a.manifest.FileStats[info.OriginalPath] = stat
+		}
+	}
+	resolveUnderlyingKinds(a.manifest.Fragments)
+	resolveReceiverConstraints(a.manifest.Fragments)
+	a.manifest.NameConflicts = findNameConflicts(a.manifest.Fragments)
+	for _, conflict := range a.manifest.NameConflicts {
+		a.logger.Printf("Avertissement: %s déclaré comme type et fonction dans %s: %s\n",
+			conflict.Identifier, conflict.Package, strings.Join(conflict.FragmentIDs, ", "))
+	}
+	// Un manifeste volontairement partiel (-name-filter, -dirty-only, -exported-only) a des receveurs absents attendus.
+	if a.opts.NameFilter == nil && !a.opts.DirtyOnly && !a.opts.ExportedOnly {
+		if orphans := flagOrphanedReceivers(a.manifest.Fragments); len(orphans) > 0 {
+			for _, id := range orphans {
+				info := a.manifest.Fragments[id]
+				a.logger.Printf("Avertissement: Méthode sans type receveur %s: %s (%s:%d)\n",
+					receiverBaseName(info.ReceiverType), id, info.OriginalPath, info.StartLine)
+			}
+			a.logger.Printf("%d méthode(s) orpheline(s): fichier manquant, type exclu par build tag ou échec de parsing?\n", len(orphans))
+		}
+	}
+	resolveEffectiveMethods(a.manifest.Fragments)
+	for _, id := range flagAmbiguousMethods(a.manifest.Fragments) {
+		info := a.manifest.Fragments[id]
+		a.logger.Printf("Avertissement: Méthodes promues ambiguës dans %s: %s (%s:%d)\n",
+			info.Identifier, strings.Join(info.AmbiguousMethods, ", "), info.OriginalPath, info.StartLine)
+	}
+	if a.opts.ResolveImplementations {
+		a.logger.Printf("Résolution des implémentations d'interfaces...\n")
+		resolveImplementations(a.manifest.Fragments)
+	}
+	if a.opts.AnalyzeImports || a.opts.PackageDigests || a.opts.APIHashes {
+		a.manifest.Packages = aggregatePackages(a.manifest.Fragments)
+	}
+	if a.opts.AnalyzeImports {
+		for _, info := range a.manifest.Fragments {
+			pkg := a.manifest.Packages[packageKey(info)]
+			for _, importPath := range info.ImportsUsed {
+				pkg.ImportUsage[importPath]++
+			}
+		}
+	}
+	if a.opts.PackageDigests {
+		computePackageDigests(a.manifest.Fragments, a.manifest.Packages, a.opts.contentDigest)
+	}
+	if a.opts.APIHashes {
+		computePublicAPIHashes(a.manifest.Fragments, a.manifest.Packages, a.opts.contentDigest)
+	}
+	var longFuncs []string
+	if a.opts.MaxFuncLines > 0 {
+		longFuncs = flagLongFunctions(a.manifest.Fragments, a.opts.MaxFuncLines)
+		for _, id := range longFuncs {
+			info := a.manifest.Fragments[id]
+			a.logger.Printf("Fonction trop longue (%d lignes > %d): %s (%s:%d)\n",
+				info.EndLine-info.StartLine, a.opts.MaxFuncLines, id, info.OriginalPath, info.StartLine)
+		}
+		a.logger.Printf("%d fonction(s) dépassent %d lignes.\n", len(longFuncs), a.opts.MaxFuncLines)
+	}
+	if a.opts.MaxParams > 0 {
+		manyParams := flagTooManyParams(a.manifest.Fragments, a.opts.MaxParams)
+		for _, id := range manyParams {
+			info := a.manifest.Fragments[id]
+			a.logger.Printf("Trop de paramètres (%d > %d): %s (%s:%d)\n",
+				info.paramCount, a.opts.MaxParams, id, info.OriginalPath, info.StartLine)
+		}
+		a.logger.Printf("%d fonction(s) dépassent %d paramètres.\n", len(manyParams), a.opts.MaxParams)
+	}
+
+	if a.opts.CheckUnexportedResults {
+		leaks := flagUnexportedResults(a.manifest.Fragments)
+		for _, id := range leaks {
+			info := a.manifest.Fragments[id]
+			a.logger.Printf("Type non exporté retourné: %s (%s:%d) %s\n", id, info.OriginalPath, info.StartLine, info.Signature)
+		}
+		a.logger.Printf("%d fonction(s) exportée(s) retournent un type non exporté.\n", len(leaks))
+	}
+	undocumented, exportedCount := flagUndocumented(a.manifest.Fragments)
+	docCoverageFailed := false
+	if a.opts.MinDocCoverage > 0 {
+		coverage := 100.0
+		if exportedCount > 0 {
+			coverage = 100 * float64(exportedCount-len(undocumented)) / float64(exportedCount)
+		}
+		a.logger.Printf("Couverture de documentation: %.1f%% (%d/%d fragments exportés).\n",
+			coverage, exportedCount-len(undocumented), exportedCount)
+		if coverage < a.opts.MinDocCoverage {
+			docCoverageFailed = true
+			for _, id := range undocumented {
+				info := a.manifest.Fragments[id]
+				a.logger.Printf("Non documenté: %s (%s:%d)\n", id, info.OriginalPath, info.StartLine)
+			}
+			a.logger.Printf("Couverture inférieure au seuil de %.1f%%.\n", a.opts.MinDocCoverage)
+		}
+	}
+
+	if a.opts.RenderDocs {
+		renderDocstrings(a.manifest.Fragments)
+	}
+	if a.opts.ChangedPackagesOnly {
+		if a.baseline.DigestAlgorithm != a.manifest.DigestAlgorithm {
+			a.logger.Printf("Avertissement: -baseline utilise d'autres digests (%q): tous les paquets apparaîtront modifiés.\n", a.baseline.DigestAlgorithm)
+		}
+		keepChangedPackages(&a.manifest, a.baseline)
+		a.logger.Printf("Delta: %d paquet(s) modifié(s), %d inchangé(s), %d supprimé(s).\n",
+			len(a.manifest.Packages), len(a.manifest.UnchangedPackages), len(a.manifest.RemovedPackages))
+	}
+	if a.opts.KeyBy == "qualified" {
+		rekeyByQualifiedName(&a.manifest)
+	}
+	if a.opts.InternImports {
+		internImports(&a.manifest)
+	}
+	if a.opts.EnrichCmd != "" {
+		a.logger.Printf("Enrichissement des fragments par %q...\n", a.opts.EnrichCmd)
+		if failed := enrichFragments(a.manifest.Fragments, a.opts.EnrichCmd, a.opts.EnrichJobs, a.logger); failed > 0 {
+			a.logger.Printf("Avertissement: enrichissement échoué pour %d fragment(s).\n", failed)
+		}
+	}
+
+	a.checksFailed = a.opts.FailOnLongFunc && len(longFuncs) > 0 || docCoverageFailed
+}
+
+// sortedFragmentEntries retourne les fragments avec leur ID, triés par OriginalPath, StartLine puis ID.
+func sortedFragmentEntries(fragments map[string]FragmentInfo) []FragmentEntry {
+	entries := make([]FragmentEntry, 0, len(fragments))
+	for id, info := range fragments {
+		entries = append(entries, FragmentEntry{ID: id, FragmentInfo: info})
+	}
+	sort.Slice(entries, func(i, j int) bool { return fragmentEntryLess(entries[i], entries[j]) })
+	return entries
+}
+
+// fragmentEntryLess ordonne les fragments par OriginalPath, StartLine puis ID (ordre de -format json-array).
+func fragmentEntryLess(a, b FragmentEntry) bool {
+	if a.OriginalPath != b.OriginalPath {
+		return a.OriginalPath < b.OriginalPath
+	}
+	if a.StartLine != b.StartLine {
+		return a.StartLine < b.StartLine
+	}
+	return a.ID < b.ID
+}
+
+// printJSON écrit v en JSON indenté sur out.
+func printJSON(out io.Writer, v interface{}) error {
+	jsonData, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling JSON: %w", err)
+	}
+	if _, err := fmt.Fprintln(out, string(jsonData)); err != nil {
+		return fmt.Errorf("écriture de la sortie: %w", err)
+	}
+	return nil
+}
+
+// writeNDJSON écrit chaque fragment sur sa propre ligne JSON (-ndjson). Chaque ligne est
+// complète au moment de son écriture: un échec ultérieur laisse un flux valide, tronqué.
+// Seule la fusion l'appelle: un seul goroutine écrit dans out, les lignes ne s'entrelacent
+// pas quel que soit -j, et out n'a pas à être sûr en concurrence.
+func writeNDJSON(out io.Writer, entries []FragmentEntry) error {
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("marshalling JSON de %s: %w", entry.ID, err)
+		}
+		if _, err := out.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("écriture de la sortie: %w", err)
+		}
+	}
+	return nil
+}
+
+// --- Déversement des fragments sur disque (-spill-dir) ---
+
+// fragmentSpill écrit les fragments par lots dans des fichiers NDJSON (un FragmentEntry par ligne)
+// pour borner la mémoire pendant le parcours. Seuls les IDs restent en mémoire: ils servent à
+// appliquer au moment de la fusion la règle du manifeste en mémoire (le dernier fragment d'un ID l'emporte).
+// Les passes par fragment (Undocumented, points d'entrée) sont appliquées à chaque lot. Les
+// références d'appels et de types sont écrites avec le fragment et résolues par noms à la fusion
+// (direct_calls_internal, types_used_internal), après une relecture des lots qui indexe les noms.
+// Les autres passes qui croisent les fragments (underlying_kind hérité, orphaned_receiver,
+// effective_methods, name_conflicts, ambiguous_methods) ne sont pas calculées.
+type fragmentSpill struct {
+	dir       string
+	byPath    bool           // Lots triés dans l'ordre de json-array plutôt que par ID
+	files     []string       // Lots dans l'ordre d'écriture
+	lastChunk map[string]int // ID -> indice du dernier lot qui le contient
+	names     *nameIndex     // Fonctions et types des lots, rempli par index
+}
+
+// spillEntry est une ligne de lot: le fragment et les champs internes que la fusion résout.
+type spillEntry struct {
+	FragmentEntry
+	ImportPath string         `json:"spill_import_path,omitempty"`
+	CallRefs   []spillCallRef `json:"spill_call_refs,omitempty"`
+	TypeRefs   []string       `json:"spill_type_refs,omitempty"`
+}
+
+// spillCallRef est un callRef écrit dans un lot.
+type spillCallRef struct {
+	ImportPath string `json:"import_path,omitempty"`
+	Name       string `json:"name"`
+}
+
+// newSpillEntry prépare l'écriture du fragment id dans un lot.
+func newSpillEntry(id string, info FragmentInfo) spillEntry {
+	entry := spillEntry{FragmentEntry: FragmentEntry{ID: id, FragmentInfo: info}, ImportPath: info.importPath, TypeRefs: info.typeRefs}
+	for _, ref := range info.callRefs {
+		entry.CallRefs = append(entry.CallRefs, spillCallRef{ImportPath: ref.importPath, Name: ref.name})
+	}
+	return entry
+}
+
+// info retourne le fragment relu avec ses champs internes.
+func (e spillEntry) info() FragmentInfo {
+	info := e.FragmentInfo
+	info.importPath, info.typeRefs = e.ImportPath, e.TypeRefs
+	for _, ref := range e.CallRefs {
+		info.callRefs = append(info.callRefs, callRef{importPath: ref.ImportPath, name: ref.Name})
+	}
+	return info
+}
+
+// flush écrit les fragments dans un nouveau lot, trié pour que la fusion n'ait qu'à
+// interclasser les lots, et vide la map.
+func (s *fragmentSpill) flush(fragments map[string]FragmentInfo) error {
+	if len(fragments) == 0 {
+		return nil
+	}
+	flagUndocumented(fragments)
+	chunk := len(s.files)
+	entries := make([]spillEntry, 0, len(fragments))
+	for id, info := range fragments {
+		entries = append(entries, newSpillEntry(id, info))
+		s.lastChunk[id] = chunk
+		delete(fragments, id)
+	}
+	sort.Slice(entries, func(i, j int) bool { return s.less(entries[i].FragmentEntry, entries[j].FragmentEntry) })
+	name := filepath.Join(s.dir, fmt.Sprintf("fragments-%d-%05d.ndjson", os.Getpid(), chunk))
+	if err := writeSpillChunk(name, entries); err != nil {
+		return err
+	}
+	s.files = append(s.files, name)
+	return nil
+}
+
+// less est l'ordre des lots: celui des clés de la map JSON, ou celui de json-array.
+func (s *fragmentSpill) less(a, b FragmentEntry) bool {
+	if s.byPath {
+		return fragmentEntryLess(a, b)
+	}
+	return a.ID < b.ID
+}
+
+// writeSpillChunk écrit entries en NDJSON dans name.
+func writeSpillChunk(name string, entries []spillEntry) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// index relit les lots pour indexer les noms des fragments retenus, et retourne les IDs triés
+// des fonctions main.
+func (s *fragmentSpill) index() ([]string, error) {
+	var ids []string
+	s.names = newNameIndex()
+	err := s.merge(func(entry spillEntry) error {
+		s.names.add(entry.ID, entry.info())
+		if entry.IsEntrypoint {
+			ids = append(ids, entry.ID)
+		}
+		return nil
+	})
+	sort.Strings(ids)
+	return ids, err
+}
+
+// merge interclasse les lots selon less et appelle fn pour chaque fragment retenu.
+// Un seul fragment par lot est en mémoire à la fois.
+func (s *fragmentSpill) merge(fn func(spillEntry) error) error {
+	type cursor struct {
+		chunk int
+		dec   *json.Decoder
+		head  spillEntry
+		file  *os.File
+	}
+	var cursors []*cursor
+	defer func() {
+		for _, c := range cursors {
+			c.file.Close()
+		}
+	}()
+	advance := func(c *cursor) (bool, error) {
+		c.head = spillEntry{}
+		if err := c.dec.Decode(&c.head); err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("%s: %w", c.file.Name(), err)
+		}
+		return true, nil
+	}
+	var active []*cursor
+	for chunk, name := range s.files {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		c := &cursor{chunk: chunk, dec: json.NewDecoder(bufio.NewReader(file)), file: file}
+		cursors = append(cursors, c)
+		ok, err := advance(c)
+		if err != nil {
+			return err
+		}
+		if ok {
+			active = append(active, c)
+		}
+	}
+	for len(active) > 0 {
+		min := 0
+		for i := 1; i < len(active); i++ {
+			if s.less(active[i].head.FragmentEntry, active[min].head.FragmentEntry) {
+				min = i
+			}
+		}
+		c := active[min]
+		if s.lastChunk[c.head.ID] == c.chunk {
+			if err := fn(c.head); err != nil {
+				return err
+			}
+		}
+		ok, err := advance(c)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			active = append(active[:min], active[min+1:]...)
+		}
+	}
+	return nil
+}
+
+// emit écrit le manifeste en JSON indenté, identique à printJSON, en insérant les fragments
+// des lots à la place de la map (ou du tableau avec byPath, pour json-array) vide du manifeste.
+func (s *fragmentSpill) emit(out io.Writer, manifest FragmentManifest) error {
+	asArray := s.byPath
+	var header []byte
+	var err error
+	placeholder := []byte(`"fragments": {}`)
+	if asArray {
+		header, err = json.MarshalIndent(fragmentArrayManifest{FragmentManifest: manifest, Fragments: []FragmentEntry{}}, "", "  ")
+		placeholder = []byte(`"fragments": []`)
+	} else {
+		manifest.Fragments = map[string]FragmentInfo{}
+		header, err = json.MarshalIndent(manifest, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	at := bytes.Index(header, placeholder)
+	if at < 0 {
+		return fmt.Errorf("champ fragments introuvable dans le manifeste")
+	}
+	w := bufio.NewWriter(out)
+	w.Write(header[:at+len(placeholder)-1])
+	first := true
+	err = s.merge(func(spilled spillEntry) error {
+		entry := spilled.FragmentEntry
+		info := spilled.info()
+		if len(info.callRefs) > 0 {
+			entry.DirectCallsInternal = s.names.calls(info)
+		}
+		if len(info.typeRefs) > 0 {
+			entry.TypesUsedInternal = s.names.typesUsed(entry.ID, info)
+		}
+		var data []byte
+		var err error
+		if asArray {
+			data, err = json.MarshalIndent(entry, "    ", "  ")
+		} else {
+			data, err = json.MarshalIndent(entry.FragmentInfo, "    ", "  ")
+		}
+		if err != nil {
+			return err
+		}
+		if !first {
+			w.WriteString(",")
+		}
+		first = false
+		w.WriteString("\n    ")
+		if !asArray {
+			key, _ := json.Marshal(entry.ID)
+			w.Write(key)
+			w.WriteString(": ")
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !first {
+		w.WriteString("\n  ")
+	}
+	w.Write(header[at+len(placeholder)-1:])
+	w.WriteString("\n")
+	return w.Flush()
+}
+
+// cleanup supprime les lots écrits.
+func (s *fragmentSpill) cleanup() {
+	for _, name := range s.files {
+		os.Remove(name)
+	}
+}
+
+// --- Requêtes sur un manifeste (-query) ---
+
+// QueryResult est la réponse JSON d'une requête -query.
+type QueryResult struct {
+	Query     string          `json:"query"`
+	Target    string          `json:"target"`
+	Results   []string        `json:"results"`             // IDs des fragments correspondants
+	Fragment  *FragmentInfo   `json:"fragment,omitempty"`  // Fragment demandé (fragment)
+	Fragments []FragmentEntry `json:"fragments,omitempty"` // Fragments correspondants, par ligne de début (-line-range)
+}
+
+// runQuery charge un manifeste (fichier ou stdin) et répond à une requête:
+//   - callers-of <id>: fragments dont direct_calls_internal contient id (exact si le manifeste a été généré avec -type-check);
+//   - methods-of <type>: méthodes dont le receveur a ce nom de base; si <type> est l'ID d'un fragment
+//     de type, seules les méthodes de son paquet sont retenues;
+//   - fragment <id>: le fragment lui-même.
+func runQuery(query, target, manifestPath string, out io.Writer) error {
+	manifest, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	result := QueryResult{Query: query, Target: target}
+	switch query {
+	case "callers-of":
+		if _, ok := manifest.Fragments[target]; !ok {
+			return fmt.Errorf("fragment %q absent du manifeste", target)
+		}
+		result.Results = []string{}
+		for id, info := range manifest.Fragments {
+			for _, callee := range info.DirectCallsInternal {
+				if callee == target {
+					result.Results = append(result.Results, id)
+					break
+				}
+			}
+		}
+	case "methods-of":
+		typeName, pkg := target, ""
+		if typeInfo, ok := manifest.Fragments[target]; ok && typeInfo.FragmentType == "type" {
+			typeName, pkg = typeInfo.Identifier, packageKey(typeInfo)
+		}
+		result.Results = []string{}
+		for id, info := range manifest.Fragments {
+			if info.FragmentType == "method" && receiverBaseName(info.ReceiverType) == typeName &&
+				(pkg == "" || packageKey(info) == pkg) {
+				result.Results = append(result.Results, id)
+			}
+		}
+	case "fragment":
+		info, ok := manifest.Fragments[target]
+		if !ok {
+			return fmt.Errorf("fragment %q absent du manifeste", target)
+		}
+		result.Results = []string{target}
+		result.Fragment = &info
+	}
+	sort.Strings(result.Results)
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// loadManifest lit un manifeste JSON depuis manifestPath (stdin si vide) et le migre
+// vers la version courante du schéma.
+func loadManifest(manifestPath string) (FragmentManifest, error) {
+	var in io.Reader = os.Stdin
+	if manifestPath != "" {
+		file, err := os.Open(manifestPath)
+		if err != nil {
+			return FragmentManifest{}, err
+		}
+		defer file.Close()
+		in = file
+	}
+	var manifest FragmentManifest
+	if err := json.NewDecoder(bufio.NewReader(in)).Decode(&manifest); err != nil {
+		return FragmentManifest{}, fmt.Errorf("manifeste illisible: %w", err)
+	}
+	if err := migrateManifest(&manifest); err != nil {
+		return FragmentManifest{}, err
+	}
+	return manifest, nil
+}
+
+// fragmentsInLineRange renvoie les fragments du fichier file (OriginalPath ou ActualSourcePath,
+// pour qu'un éditeur ouvert sur le .templ retrouve ses composants) dont l'étendue
+// [StartLine, EndLine] chevauche [start, end]: un fragment qui déborde de la plage est retenu.
+func fragmentsInLineRange(fragments map[string]FragmentInfo, file string, start, end int) QueryResult {
+	file = filepath.ToSlash(filepath.Clean(file))
+	result := QueryResult{
+		Query:   "line-range",
+		Target:  fmt.Sprintf("%s:%d:%d", file, start, end),
+		Results: []string{},
+	}
+	for _, entry := range sortedFragmentEntries(fragments) {
+		if entry.OriginalPath != file && entry.ActualSourcePath != file {
+			continue
+		}
+		if entry.StartLine <= end && entry.EndLine >= start {
+			result.Fragments = append(result.Fragments, entry)
+		}
+	}
+	sort.SliceStable(result.Fragments, func(i, j int) bool {
+		return result.Fragments[i].StartLine < result.Fragments[j].StartLine
+	})
+	for _, entry := range result.Fragments {
+		result.Results = append(result.Results, entry.ID)
+	}
+	return result
+}
+
+// --- Comparaison de manifestes ---
+
+// runBatchDiff lit une suite de manifestes JSON (typiquement un par ligne, dans l'ordre des commits)
+// et écrit sur out, pour chaque paire consécutive, une ligne JSON ManifestDiff.
+// Un seul manifeste est gardé en mémoire en plus du courant.
+func runBatchDiff(manifestsPath string, out io.Writer) error {
+	file, err := os.Open(manifestsPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(file))
+	enc := json.NewEncoder(out)
+	var previous *FragmentManifest
+	for index := 0; ; index++ {
+		var current FragmentManifest
+		if err := dec.Decode(&current); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("manifeste n°%d illisible: %w", index, err)
+		}
+		if err := migrateManifest(&current); err != nil {
+			return fmt.Errorf("manifeste n°%d: %w", index, err)
+		}
+		if previous != nil {
+			diff := diffManifests(*previous, current)
+			diff.From, diff.To = index-1, index
+			if err := enc.Encode(diff); err != nil {
+				return err
+			}
+		}
+		previous = &current
+	}
+	return nil
+}
+
+// migrateManifest met à niveau un manifeste chargé vers manifestSchemaVersion en complétant
+// les valeurs par défaut des champs introduits depuis sa version. Un manifeste plus récent que
+// l'outil est refusé: ses champs inconnus seraient perdus silencieusement.
+func migrateManifest(m *FragmentManifest) error {
+	if m.SchemaVersion > manifestSchemaVersion {
+		return fmt.Errorf("version de schéma %d plus récente que celle supportée (%d): mettez à jour ast_parser", m.SchemaVersion, manifestSchemaVersion)
+	}
+	if m.Fragments == nil {
+		m.Fragments = make(map[string]FragmentInfo)
+	}
+	if m.SchemaVersion < 1 {
+		// v0 -> v1: les lignes physiques valent les lignes rapportées (pas de directive //line connue).
+		for id, info := range m.Fragments {
+			if info.RawLine == 0 && info.RawEndLine == 0 {
+				info.RawLine, info.RawEndLine = info.StartLine, info.EndLine
+				m.Fragments[id] = info
+			}
+		}
+	}
+	if m.SchemaVersion < 2 {
+		// v1 -> v2: package_dir se déduit de original_path.
+		for id, info := range m.Fragments {
+			if info.PackageDir == "" {
+				info.PackageDir = path.Dir(info.OriginalPath)
+				m.Fragments[id] = info
+			}
+		}
+	}
+	m.SchemaVersion = manifestSchemaVersion
+	return nil
+}
+
+// diffManifests compare deux manifestes par ID de fragment et CodeDigest.
+func diffManifests(before, after FragmentManifest) ManifestDiff {
+	diff := ManifestDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for id, newInfo := range after.Fragments {
+		oldInfo, ok := before.Fragments[id]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, id)
+		case oldInfo.CodeDigest != newInfo.CodeDigest:
+			diff.Changed = append(diff.Changed, id)
+		}
+	}
+	for id := range before.Fragments {
+		if _, ok := after.Fragments[id]; !ok {
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// --- Formats de sortie ---
+
+// ctagsKinds associe un FragmentType à la lettre de kind ctags.
+var ctagsKinds = map[string]string{
+	"function":    "f",
+	"method":      "m",
+	"type":        "t",
+	"constant":    "c",
+	"variable":    "v",
+	"const_group": "c",
+}
+
+// writeYAML écrit v en YAML (format yaml). La valeur passe par encoding/json: les clés sont
+// celles des tags json, omitempty est respecté et l'ordre est celui de la sortie JSON, donc
+// stable d'une exécution à l'autre. Le JSON, déjà du YAML valide, est relu en yaml.Node pour
+// garder cet ordre, puis réécrit en style bloc; les chaînes multilignes en bloc littéral (|).
+func writeYAML(out io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	blockStyle(&doc)
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// blockStyle remplace récursivement le style JSON (flux, guillemets doubles) par le style par
+// défaut de yaml.v3, et le style littéral pour les chaînes multilignes.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && strings.Contains(node.Value, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// writeCtags écrit les fragments au format ctags étendu (une ligne par fragment, triée par nom):
+// nom<TAB>fichier<TAB>ligne;"<TAB>kind<TAB>champs étendus (line, package, receiver).
+// Les chemins sont relatifs à la racine analysée: le fichier tags est à placer à cette racine.
+func writeCtags(out io.Writer, fragments map[string]FragmentInfo) error {
+	lines := make([]string, 0, len(fragments))
+	for _, info := range fragments {
+		kind, ok := ctagsKinds[info.FragmentType]
+		if !ok {
+			kind = "u"
+		}
+		line := fmt.Sprintf("%s\t%s\t%d;\"\t%s\tline:%d\tpackage:%s",
+			info.Identifier, info.OriginalPath, info.StartLine, kind, info.StartLine, info.PackageName)
+		if info.ReceiverType != "" {
+			line += "\treceiver:" + info.ReceiverType
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, "!_TAG_FILE_FORMAT\t2\t/extended format; --format=1 will not append ;\" to lines/")
+	fmt.Fprintln(w, "!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/")
+	fmt.Fprintln(w, "!_TAG_PROGRAM_NAME\tast_parser\t//")
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+	return w.Flush()
+}
+
+// gitHubAnnotation est une commande de workflow GitHub Actions rattachée à une ligne.
+type gitHubAnnotation struct {
+	level   string // notice ou warning
+	file    string
+	line    int
+	endLine int
+	title   string
+	message string
+}
+
+// fragmentAnnotations retourne les annotations d'un fragment pour chaque signalement posé
+// par les vérifications (-max-func-lines, -max-params, -detect-lock-leaks, ...). Undocumented
+// étant toujours calculé, il n'est annoté que si withUndocumented (-min-doc-coverage).
+func fragmentAnnotations(id string, info FragmentInfo, withUndocumented bool) []gitHubAnnotation {
+	var notes []gitHubAnnotation
+	add := func(level, title, message string) {
+		notes = append(notes, gitHubAnnotation{level: level, file: info.OriginalPath,
+			line: info.RawLine, endLine: info.RawEndLine, title: title, message: message + " (" + id + ")"})
+	}
+	if info.PossibleLockLeak {
+		add("warning", "Verrou non libéré", info.Identifier+" appelle Lock/RLock sans Unlock/RUnlock correspondant")
+	}
+	if info.PossibleLoopVarCapture {
+		add("warning", "Capture de variable de boucle", info.Identifier+" lance une goroutine qui capture une variable de boucle")
+	}
+	if info.OrphanedReceiver {
+		add("warning", "Receveur orphelin", "aucun type "+receiverBaseName(info.ReceiverType)+" trouvé pour la méthode "+info.Identifier)
+	}
+	if info.TooLong {
+		add("notice", "Fonction trop longue", fmt.Sprintf("%s fait %d lignes", info.Identifier, info.EndLine-info.StartLine))
+	}
+	if info.TooManyParams {
+		add("notice", "Trop de paramètres", fmt.Sprintf("%s a %d paramètres", info.Identifier, info.paramCount))
+	}
+	if info.LeaksUnexportedType {
+		add("notice", "Type non exporté retourné", info.Identifier+" retourne un type non exporté du paquet")
+	}
+	if info.FieldAlignmentSavings > 0 {
+		add("notice", "Padding de struct", fmt.Sprintf("réordonner les champs de %s économiserait %d octets", info.Identifier, info.FieldAlignmentSavings))
+	}
+	if withUndocumented && info.Undocumented {
+		add("notice", "Symbole non documenté", info.Identifier+" est exporté sans commentaire de documentation")
+	}
+	return notes
+}
+
+// writeGitHubAnnotations écrit une commande ::warning ou ::notice par signalement, triées par
+// fichier puis ligne, et retourne leur nombre. Les chemins sont ceux du manifeste (relatifs à
+// la racine analysée, cf. -strip-prefix) et les lignes sont physiques (RawLine).
+func writeGitHubAnnotations(out io.Writer, manifest FragmentManifest, withUndocumented bool) (int, error) {
+	var notes []gitHubAnnotation
+	for id, info := range manifest.Fragments {
+		notes = append(notes, fragmentAnnotations(id, info, withUndocumented)...)
+	}
+	for _, conflict := range manifest.NameConflicts {
+		for _, id := range conflict.FragmentIDs {
+			info := manifest.Fragments[id]
+			notes = append(notes, gitHubAnnotation{level: "warning", file: info.OriginalPath, line: info.RawLine, endLine: info.RawEndLine,
+				title: "Conflit de noms", message: conflict.Identifier + " est déclaré à la fois comme type et fonction dans le paquet"})
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if notes[i].file != notes[j].file {
+			return notes[i].file < notes[j].file
+		}
+		if notes[i].line != notes[j].line {
+			return notes[i].line < notes[j].line
+		}
+		return notes[i].title < notes[j].title
+	})
+
+	w := bufio.NewWriter(out)
+	for _, n := range notes {
+		fmt.Fprintf(w, "::%s file=%s,line=%d,endLine=%d,title=%s::%s\n", n.level,
+			escapeAnnotationProperty(n.file), n.line, n.endLine, escapeAnnotationProperty(n.title), escapeAnnotationData(n.message))
+	}
+	return len(notes), w.Flush()
+}
+
+// escapeAnnotationData échappe le message d'une commande de workflow GitHub.
+func escapeAnnotationData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeAnnotationProperty échappe une propriété (file, title) d'une commande de workflow GitHub.
+func escapeAnnotationProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// lsifEmitter écrit un dump LSIF (un objet JSON par ligne) en numérotant vertex et edges.
+type lsifEmitter struct {
+	enc    *json.Encoder
+	nextID int
+	err    error
+}
+
+func (e *lsifEmitter) emit(kind, label string, fields map[string]interface{}) int {
+	e.nextID++
+	fields["id"] = e.nextID
+	fields["type"] = kind
+	fields["label"] = label
+	if e.err == nil {
+		e.err = e.enc.Encode(fields)
+	}
+	return e.nextID
+}
+
+func (e *lsifEmitter) vertex(label string, fields map[string]interface{}) int {
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	return e.emit("vertex", label, fields)
+}
+
+// edge émet un edge 1:1 (next, textDocument/*).
+func (e *lsifEmitter) edge(label string, outV, inV int) {
+	e.emit("edge", label, map[string]interface{}{"outV": outV, "inV": inV})
+}
+
+// edgeN émet un edge 1:n (contains, item); document n'est renseigné que s'il est non nul.
+func (e *lsifEmitter) edgeN(label string, outV int, inVs []int, document int) {
+	fields := map[string]interface{}{"outV": outV, "inVs": inVs}
+	if document != 0 {
+		fields["document"] = document
+	}
+	e.emit("edge", label, fields)
+}
+
+// writeLSIF écrit un dump LSIF (0.4.3) limité aux définitions, construit à partir des positions
+// des fragments. Vertices émis: metaData, project, document, range, resultSet, definitionResult,
+// hoverResult. Edges émis: contains, next, textDocument/definition, textDocument/hover, item.
+// Les références (referenceResult) ne sont pas émises: le manifeste ne conserve pas la position
+// des sites d'appel. Les plages couvrent l'identifiant déclaré; les colonnes sont en octets,
+// ce qui coïncide avec l'UTF-16 attendu pour les identifiants ASCII.
+func writeLSIF(out io.Writer, fragments map[string]FragmentInfo, projectRootDirAbs string) error {
+	w := bufio.NewWriter(out)
+	e := &lsifEmitter{enc: json.NewEncoder(w)}
+	rootURI := "file://" + filepath.ToSlash(projectRootDirAbs)
+
+	e.vertex("metaData", map[string]interface{}{
+		"version":          "0.4.3",
+		"projectRoot":      rootURI,
+		"positionEncoding": "utf-16",
+		"toolInfo":         map[string]interface{}{"name": "ast_parser"},
+	})
+	projectID := e.vertex("project", map[string]interface{}{"kind": "go"})
+
+	// Fragments groupés par fichier, dans un ordre stable.
+	byFile := make(map[string][]FragmentInfo)
+	for _, info := range fragments {
+		byFile[info.OriginalPath] = append(byFile[info.OriginalPath], info)
+	}
+	files := make([]string, 0, len(byFile))
+	for file := range byFile {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var documentIDs []int
+	for _, file := range files {
+		infos := byFile[file]
+		sort.Slice(infos, func(i, j int) bool {
+			if infos[i].nameLine != infos[j].nameLine {
+				return infos[i].nameLine < infos[j].nameLine
+			}
+			return infos[i].nameColumn < infos[j].nameColumn
+		})
+		documentID := e.vertex("document", map[string]interface{}{
+			"uri":        rootURI + "/" + file,
+			"languageId": "go",
+		})
+		documentIDs = append(documentIDs, documentID)
+
+		var rangeIDs []int
+		for _, info := range infos {
+			if info.nameLine == 0 {
+				continue
+			}
+			line, char := info.nameLine-1, info.nameColumn-1 // LSIF: positions à partir de 0
+			rangeID := e.vertex("range", map[string]interface{}{
+				"start": map[string]int{"line": line, "character": char},
+				"end":   map[string]int{"line": line, "character": char + len(info.Identifier)},
+			})
+			rangeIDs = append(rangeIDs, rangeID)
+
+			resultSetID := e.vertex("resultSet", nil)
+			e.edge("next", rangeID, resultSetID)
+			definitionID := e.vertex("definitionResult", nil)
+			e.edge("textDocument/definition", resultSetID, definitionID)
+			e.edgeN("item", definitionID, []int{rangeID}, documentID)
+			contents := []interface{}{map[string]string{"language": "go", "value": lsifHoverCode(info)}}
+			if info.Docstring != "" {
+				contents = append(contents, info.Docstring)
+			}
+			hoverID := e.vertex("hoverResult", map[string]interface{}{
+				"result": map[string]interface{}{"contents": contents},
+			})
+			e.edge("textDocument/hover", resultSetID, hoverID)
+		}
+		if len(rangeIDs) > 0 {
+			e.edgeN("contains", documentID, rangeIDs, 0)
+		}
+	}
+	if len(documentIDs) > 0 {
+		e.edgeN("contains", projectID, documentIDs, 0)
+	}
+	if e.err != nil {
+		return e.err
+	}
+	return w.Flush()
+}
+
+// lsifHoverCode retourne le code affiché au survol: la signature ou la définition du fragment.
+func lsifHoverCode(info FragmentInfo) string {
+	if info.Signature != "" {
+		return info.Signature
+	}
+	if info.Definition != "" {
+		return info.Definition
+	}
+	return info.Identifier
+}
+
+// htmlFragment est un fragment tel qu'affiché dans le rapport HTML.
+type htmlFragment struct {
+	ID       string
+	Name     string // Identifier, préfixé du receveur pour les méthodes
+	Code     string // Signature ou définition
+	Info     FragmentInfo
+	Calls    []string // IDs des fragments appelés présents dans le manifeste
+	CalledBy []string // IDs des fragments appelants
+}
+
+// htmlPackage regroupe les fragments d'un paquet dans le rapport HTML.
+type htmlPackage struct {
+	Dir       string
+	Name      string
+	Fragments []htmlFragment
+}
+
+// htmlReportTemplate est le rapport HTML autonome (CSS et JS en ligne): un bloc repliable par
+// paquet, et des liens entre appelants et appelés quand le graphe d'appels est disponible.
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="fr">
+<head>
+<meta charset="utf-8">
+<title>Manifeste {{.Root}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+summary { cursor: pointer; font-weight: bold; padding: .3em 0; }
+section { margin: .5em 0 1em 1.5em; padding-left: .8em; border-left: 3px solid #ddd; }
+section:target { border-left-color: #e90; }
+h3 { margin: .2em 0; font-size: 1em; }
+.kind { color: #666; font-weight: normal; }
+small { color: #888; font-weight: normal; }
+pre { background: #f6f6f6; padding: .5em; overflow-x: auto; }
+.doc { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>Manifeste {{.Root}}</h1>
+<p>{{.FragmentCount}} fragments dans {{len .Packages}} paquets.</p>
+{{range .Packages}}<details>
+<summary>{{.Dir}} &mdash; package {{.Name}} ({{len .Fragments}})</summary>
+{{range .Fragments}}<section id="{{.ID}}">
+<h3><span class="kind">{{.Info.FragmentType}}</span> {{.Name}} <small>{{.Info.OriginalPath}}:{{.Info.StartLine}}</small></h3>
+<pre>{{.Code}}</pre>
+{{with .Info.Docstring}}<p class="doc">{{.}}</p>
+{{end}}{{if .Calls}}<p>Appelle: {{range .Calls}}<a href="#{{.}}">{{.}}</a> {{end}}</p>
+{{end}}{{if .CalledBy}}<p>Appelé par: {{range .CalledBy}}<a href="#{{.}}">{{.}}</a> {{end}}</p>
+{{end}}</section>
+{{end}}</details>
+{{end}}<script>
+// Ouvre les paquets repliés contenant le fragment ciblé par un lien.
+function openTarget() {
+  var e = document.getElementById(decodeURIComponent(location.hash.slice(1)));
+  for (; e; e = e.parentElement) { if (e.tagName === "DETAILS") { e.open = true; } }
+}
+window.addEventListener("hashchange", openTarget);
+openTarget();
+</script>
+</body>
+</html>
+`))
+
+// writeHTML écrit un rapport HTML autonome du manifeste, destiné à une lecture humaine.
+// Les paquets sont triés par dossier, leurs fragments par fichier puis ligne.
+func writeHTML(out io.Writer, manifest FragmentManifest, projectRootDirAbs string) error {
+	calledBy := make(map[string][]string)
+	for id, info := range manifest.Fragments {
+		for _, callee := range info.DirectCallsInternal {
+			calledBy[callee] = append(calledBy[callee], id)
+		}
+	}
+
+	packages := make(map[string]*htmlPackage)
+	for id, info := range manifest.Fragments {
+		key := packageKey(info)
+		pkg, ok := packages[key]
+		if !ok {
+			pkg = &htmlPackage{Dir: info.PackageDir, Name: info.PackageName}
+			packages[key] = pkg
+		}
+		f := htmlFragment{ID: id, Name: info.Identifier, Code: lsifHoverCode(info), Info: info, CalledBy: calledBy[id]}
+		if info.ReceiverType != "" {
+			f.Name = "(" + info.ReceiverType + ")." + info.Identifier
+		}
+		for _, callee := range info.DirectCallsInternal {
+			if _, ok := manifest.Fragments[callee]; ok {
+				f.Calls = append(f.Calls, callee)
+			}
+		}
+		sort.Strings(f.CalledBy)
+		pkg.Fragments = append(pkg.Fragments, f)
+	}
+
+	data := struct {
+		Root          string
+		FragmentCount int
+		Packages      []*htmlPackage
+	}{Root: filepath.Base(projectRootDirAbs), FragmentCount: len(manifest.Fragments)}
+	keys := make([]string, 0, len(packages))
+	for key := range packages {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		pkg := packages[key]
+		sort.Slice(pkg.Fragments, func(i, j int) bool {
+			a, b := pkg.Fragments[i].Info, pkg.Fragments[j].Info
+			if a.OriginalPath != b.OriginalPath {
+				return a.OriginalPath < b.OriginalPath
+			}
+			return a.StartLine < b.StartLine
+		})
+		data.Packages = append(data.Packages, pkg)
+	}
+	return htmlReportTemplate.Execute(out, data)
+}
+
+// defaultSkippedDirs associe les dossiers ignorés par défaut à la raison rapportée par -dry-run.
+var defaultSkippedDirs = map[string]string{
+	".git":          "dossier exclu par défaut",
+	"vendor":        "dossier exclu par défaut",
+	"node_modules":  "dossier exclu par défaut",
+	"venv":          "dossier exclu par défaut",
+	".idea":         "dossier exclu par défaut",
+	".vscode":       "dossier exclu par défaut",
+	"tmp_go_format": "dossier exclu par défaut",
+	"static":        "dossier d'assets statiques", // Assets statiques courants
+	"public":        "dossier d'assets statiques",
+}
+
+// DirSkipRules décide des dossiers ignorés au parcours. Une entrée est un nom de dossier
+// (static: tous les dossiers static) ou, si elle contient un "/", un chemin relatif à la racine
+// (web/static). Priorité: -include-dir-override l'emporte sur -exclude-dir, les exclusions par
+// défaut et les dossiers cachés; le chemin relatif est testé avant le nom.
+type DirSkipRules struct {
+	Excluded   map[string]string // Nom ou chemin relatif -> raison
+	Included   map[string]bool   // -include-dir-override
+	SkipHidden bool              // Ignorer les dossiers dont le nom commence par "." (-skip-hidden-dirs)
+}
+
+// reason retourne la raison pour laquelle un dossier est ignoré, ou "" s'il est parcouru.
+func (r DirSkipRules) reason(dirName, relPath string) string {
+	if r.Included[relPath] || r.Included[dirName] {
+		return ""
+	}
+	if reason, ok := r.Excluded[relPath]; ok {
+		return reason
+	}
+	if reason, ok := r.Excluded[dirName]; ok {
+		return reason
+	}
+	if r.SkipHidden && strings.HasPrefix(dirName, ".") {
+		return "dossier caché"
+	}
+	return ""
+}
+
+// gitignoreRule est une ligne d'un fichier .gitignore, relative au dossier qui le contient.
+type gitignoreRule struct {
+	baseDir  string   // Dossier absolu du .gitignore
+	segments []string // Motif découpé sur "/" (les segments "**" couvrent zéro ou plusieurs dossiers)
+	anchored bool     // Le motif contient un "/": comparé au chemin relatif à baseDir, sinon au seul nom
+	negate   bool     // "!motif": ré-inclut ce qu'une règle précédente excluait
+	dirOnly  bool     // "motif/": ne s'applique qu'aux dossiers
+}
+
+// gitignoreMatcher accumule les règles des .gitignore rencontrés pendant le parcours
+// (-respect-gitignore). Comme pour git, la dernière règle applicable l'emporte, et un fichier
+// d'un dossier exclu ne peut pas être ré-inclus (le dossier n'est pas parcouru).
+type gitignoreMatcher struct {
+	rules []gitignoreRule
+}
+
+// load ajoute les règles de dir/.gitignore s'il existe; un dossier sans .gitignore ne change rien.
+func (m *gitignoreMatcher) load(src sourceFS, dir string) error {
+	data, err := src.readFile(filepath.Join(dir, ".gitignore"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasSuffix(line, "\\ ") {
+			line = strings.TrimRight(line, " ")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := gitignoreRule{baseDir: dir}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, "\\#") || strings.HasPrefix(line, "\\!") {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.anchored = strings.Contains(line, "/")
+		rule.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+		m.rules = append(m.rules, rule)
+	}
+	return nil
+}
+
+// ignored indique si le fichier ou dossier absolu p est exclu par les règles chargées.
+func (m *gitignoreMatcher) ignored(p string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.baseDir, p)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue // Hors du dossier du .gitignore
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if !rule.anchored {
+			parts = parts[len(parts)-1:]
+		}
+		if matchGitignoreSegments(rule.segments, parts) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matchGitignoreSegments compare un motif découpé à un chemin découpé. Chaque segment suit
+// path.Match (*, ?, [...]); "**" couvre zéro ou plusieurs segments, sauf en fin de motif où
+// il en faut au moins un ("build/**" couvre le contenu de build, pas build lui-même).
+func matchGitignoreSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			return len(parts) > 0
+		}
+		for i := 0; i <= len(parts); i++ {
+			if matchGitignoreSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, err := path.Match(pattern[0], parts[0]); err != nil || !ok {
+		return false
+	}
+	return matchGitignoreSegments(pattern[1:], parts[1:])
+}
+
+// relativeSlashPath retourne p relatif à root avec des "/", ou p lui-même en cas d'échec.
+func relativeSlashPath(root, p string) string {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// sourceFS est le système de fichiers que lit l'analyse, adressé par chemins absolus comme le
+// disque: root est le chemin absolu de la racine "." de fsys.
+type sourceFS struct {
+	fsys fs.FS
+	root string
+}
+
+// diskSource retourne le disque, monté à la racine du volume de dir.
+func diskSource(dir string) sourceFS {
+	root := filepath.VolumeName(dir) + string(filepath.Separator)
+	return sourceFS{fsys: os.DirFS(root), root: root}
+}
+
+// name retourne le nom fs.FS du chemin absolu p. Un chemin hors de root donne un nom
+// invalide ("../..."), que fsys refuse.
+func (s sourceFS) name(p string) string {
+	return relativeSlashPath(s.root, p)
+}
+
+func (s sourceFS) open(p string) (fs.File, error) {
+	return s.fsys.Open(s.name(p))
+}
+
+func (s sourceFS) readFile(p string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, s.name(p))
+}
+
+func (s sourceFS) stat(p string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, s.name(p))
+}
+
+// walk parcourt dir comme filepath.Walk, dans l'ordre lexical, en passant à fn des chemins
+// absolus; une entrée illisible est signalée à fn avec une information nil.
+func (s sourceFS) walk(dir string, fn filepath.WalkFunc) error {
+	return fs.WalkDir(s.fsys, s.name(dir), func(name string, d fs.DirEntry, err error) error {
+		p := filepath.Join(s.root, filepath.FromSlash(name))
+		if err != nil {
+			return fn(p, nil, err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fn(p, nil, err)
+		}
+		if name == "." {
+			// La racine de fsys s'appelle ".": les règles d'exclusion la verraient cachée.
+			info = namedFileInfo{FileInfo: info, name: filepath.Base(p)}
+		}
+		return fn(p, info, nil)
+	})
+}
+
+// namedFileInfo renomme un fs.FileInfo.
+type namedFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i namedFileInfo) Name() string { return i.name }
+
+// stripPathPrefix retire prefix (chemin à barres obliques, sans / final) du début de p,
+// uniquement sur une frontière de segment: "src/repo" retire "src/repo/x.go" -> "x.go"
+// mais laisse "src/repository/x.go" intact. Un préfixe vide ou "." ne change rien.
+func stripPathPrefix(p, prefix string) string {
+	if prefix == "" || prefix == "." {
+		return p
+	}
+	if strings.HasPrefix(p, prefix+"/") {
+		return p[len(prefix)+1:]
+	}
+	return p
+}
+
+// findTemplSourcePath tente de trouver le .templ source pour un _templ.go donné.
+// goTemplFileAbsPath: chemin absolu du fichier _templ.go.
+// projectRootDirAbs: chemin absolu de la racine du projet Go.
+// Retourne: chemin relatif du .templ par rapport à projectRootDirAbs, bool indiquant si trouvé.
+func findTemplSourcePath(src sourceFS, goTemplFileAbsPath string, projectRootDirAbs string, logger Logger) (string, bool) {
+	dir := filepath.Dir(goTemplFileAbsPath)
+	baseName := filepath.Base(goTemplFileAbsPath)
+
+	// 1. Essayer la convention de nommage: foo_templ.go -> foo.templ
+	if strings.HasSuffix(baseName, "_templ.go") {
+		templFileName := strings.TrimSuffix(baseName, "_templ.go") + ".templ"
+		potentialTemplPathAbs := filepath.Join(dir, templFileName)
+		if _, err := src.stat(potentialTemplPathAbs); err == nil {
+			relPath, errRel := filepath.Rel(projectRootDirAbs, potentialTemplPathAbs)
+			if errRel == nil {
+				return filepath.ToSlash(relPath), true
+			}
+			logger.Printf("Avertissement: Convention .templ: erreur calcul rel path pour %s (base: %s): %v\n", potentialTemplPathAbs, projectRootDirAbs, errRel)
+		}
+	}
+
+	// 2. Fallback sur le commentaire "// File: ..."
+	file, err := src.open(goTemplFileAbsPath)
+	if err != nil {
+		logger.Printf("Avertissement: Erreur ouverture %s pour commentaire .templ: %v\n", goTemplFileAbsPath, err)
+		return "", false
+	}
+	defer file.Close()
+
+	// Regex pour `// File: path/to/something.templ` (doit se terminer par .templ)
+	re := regexp.MustCompile(`^\s*//\s*File:\s*(.+\.templ)\s*$`)
+	scanner := bufio.NewScanner(file)
+	for i := 0; i < 20 && scanner.Scan(); i++ { // Limiter la recherche aux premières lignes
+		line := scanner.Text()
+		matches := re.FindStringSubmatch(line)
+		if len(matches) > 1 {
+			pathFromComment := strings.TrimSpace(matches[1])
+			// pathFromComment est relatif à la racine du projet où `templ generate` a été exécuté.
+			// On suppose que c'est projectRootDirAbs.
+			absPathFromComment := filepath.Join(projectRootDirAbs, pathFromComment)
+			if _, err := src.stat(absPathFromComment); err == nil {
+				// S'assurer de retourner le chemin relatif au projet, pas celui du commentaire brut s'il est différent
+				relPath, errRel := filepath.Rel(projectRootDirAbs, absPathFromComment)
+				if errRel == nil && (relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator))) {
+					// Un chemin hors de la racine n'a pas de sens pour les consommateurs: repli sur le _templ.go.
+					logger.Printf("Avertissement: Commentaire .templ '%s' hors de la racine du projet (%s), ignoré.\n", pathFromComment, projectRootDirAbs)
+					return "", false
+				}
+				if errRel == nil {
+					return filepath.ToSlash(relPath), true
+				}
+				logger.Printf("Avertissement: Commentaire .templ: erreur calcul rel path pour %s (base: %s): %v\n", absPathFromComment, projectRootDirAbs, errRel)
+			} else {
+				logger.Printf("Avertissement: Commentaire .templ trouvé: '%s', mais fichier inexistant à: '%s'\n", pathFromComment, absPathFromComment)
+			}
+			return "", false // Commentaire trouvé mais fichier invalide ou erreur chemin
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Printf("Erreur lecture %s pour commentaire .templ: %v\n", goTemplFileAbsPath, err)
+	}
+	return "", false // Non trouvé
+}
+
+// fragmentIDBase retourne la base des IDs de fragments du fichier en cours: "<paquet>_<fichier sans .go>".
+// Ce schéma par défaut ignore le répertoire: pour deux paquets homonymes dans des répertoires
+// différents (ex: a/utils/x.go et b/utils/x.go), la fusion ajoute le suffixe de -id-dir-hash aux
+// IDs du fichier qui n'est pas propriétaire de la base (cf. idBaseClaims).
+// Avec -root-relative-ids, la base est préfixée par le répertoire relatif à la racine ("a/utils/utils_x"),
+// ce qui garantit l'unicité des IDs dans tout le dépôt.
+// Avec -id-dir-hash, les 6 premiers caractères hexa du SHA-1 du répertoire relatif sont ajoutés
+// ("utils_x_3f2c1b"): même garantie, avec des IDs de longueur fixe.
+func (v *visitor) fragmentIDBase() string {
+	return fragmentIDBaseFor(v.opts, v.currentPackageName, v.currentOriginalPathRel)
+}
+
+// fragmentIDBaseFor calcule la base des IDs des fragments du fichier relPath du paquet packageName.
+func fragmentIDBaseFor(opts *Options, packageName, relPath string) string {
+	goFileNameWithoutExt := strings.TrimSuffix(filepath.Base(relPath), ".go")
+	base := fmt.Sprintf("%s_%s", packageName, goFileNameWithoutExt)
+	if opts.IDDirHash {
+		base += dirHashSuffix(path.Dir(relPath))
+	}
+	if opts.RootRelativeIDs {
+		if dir := path.Dir(relPath); dir != "." {
+			base = sanitizePathForID(dir) + "/" + base
+		}
+	}
+	return base
+}
+
+// dirHashSuffix retourne "_" suivi des 6 premiers caractères hexa du SHA-1 du répertoire relatif.
+func dirHashSuffix(dir string) string {
+	sum := sha1.Sum([]byte(dir))
+	return "_" + hex.EncodeToString(sum[:])[:6]
+}
+
+// idBaseClaims attribue chaque base d'ID (paquet + nom de fichier) à un dossier propriétaire,
+// dont les fichiers gardent les IDs sans suffixe. Un fichier homonyme d'un autre dossier
+// (handlers/handler.go dans a/ et b/) reçoit le suffixe de -id-dir-hash: ses fragments
+// n'écrasent plus ceux du propriétaire.
+//
+// Le propriétaire est le dossier le moins profond (puis le premier dans l'ordre lexical) parmi
+// ceux de tout l'arbre qui contiennent un fichier de ce nom dans ce paquet (scanIDBaseClaims).
+// L'ID d'un fragment ne dépend donc que de l'arbre, pas des fichiers retenus par -stdin ou
+// -dirty-only; il ne change que si un dossier moins profond (ou de même profondeur et
+// lexicalement inférieur) gagne un fichier homonyme du même paquet. Une base non attribuée
+// d'avance (noms de fichier différents: paquet a_b, fichier c.go contre paquet a, b_c.go)
+// revient au premier dossier qui la produit dans l'ordre du parcours.
+type idBaseClaims map[string]string // Base -> dossier propriétaire
+
+// scannedFile est un fichier relevé par le pré-parcours des bases d'ID.
+type scannedFile struct {
+	path    string // Chemin absolu
+	relPath string // OriginalPath
+}
+
+// scanIDBaseClaims attribue les bases d'ID des fichiers homonymes de files (même nom dans
+// plusieurs dossiers), d'après la seule clause package de chacun. Les autres fichiers ne sont
+// pas ouverts: le pré-parcours ne coûte qu'un parcours des noms, plus la lecture de l'en-tête
+// des fichiers homonymes. Un fichier sans clause package lisible est ignoré: il ne produira
+// pas de fragments.
+func scanIDBaseClaims(src sourceFS, claims idBaseClaims, files []scannedFile, opts *Options) {
+	dirsByName := make(map[string]map[string]bool)
+	for _, f := range files {
+		name := path.Base(f.relPath)
+		if dirsByName[name] == nil {
+			dirsByName[name] = make(map[string]bool)
+		}
+		dirsByName[name][path.Dir(f.relPath)] = true
+	}
+	fset := token.NewFileSet()
+	for _, f := range files {
+		if len(dirsByName[path.Base(f.relPath)]) < 2 {
+			continue
+		}
+		name, err := readPackageName(src, fset, f.path)
+		if err != nil {
+			continue
+		}
+		claims.claim(fragmentIDBaseFor(opts, name, f.relPath), path.Dir(f.relPath))
+	}
+}
+
+// packageHeaderSize est la taille lue d'abord pour trouver la clause package d'un fichier:
+// elle suit d'ordinaire quelques lignes de licence et de contraintes de build.
+const packageHeaderSize = 8 << 10
+
+// readPackageName retourne le nom du paquet déclaré par le fichier path de src, en ne lisant que
+// son en-tête; le fichier n'est lu en entier que si la clause package est au-delà.
+func readPackageName(src sourceFS, fset *token.FileSet, path string) (string, error) {
+	file, err := src.open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	head := make([]byte, packageHeaderSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+	if node, err := parser.ParseFile(fset, path, head, parser.PackageClauseOnly); err == nil {
+		return node.Name.Name, nil
+	} else if n < packageHeaderSize {
+		return "", err
+	}
+	rest, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	node, err := parser.ParseFile(fset, path, append(head, rest...), parser.PackageClauseOnly)
+	if err != nil {
+		return "", err
+	}
+	return node.Name.Name, nil
+}
+
+// claim retient dir comme propriétaire de base s'il est moins profond que le propriétaire
+// actuel, ou de même profondeur et lexicalement inférieur.
+func (c idBaseClaims) claim(base, dir string) {
+	owner, ok := c[base]
+	if !ok || dirDepth(dir) < dirDepth(owner) || dirDepth(dir) == dirDepth(owner) && dir < owner {
+		c[base] = dir
+	}
+}
+
+// dirDepth retourne le nombre de segments d'un dossier relatif ("." = 0).
+func dirDepth(dir string) int {
+	if dir == "." {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
+
+// suffix retourne le suffixe à ajouter à base pour un fichier du dossier dir ("" s'il en est
+// propriétaire). Une base non attribuée revient à dir.
+func (c idBaseClaims) suffix(base, dir string) string {
+	owner, ok := c[base]
+	if !ok {
+		c[base] = dir
+		return ""
+	}
+	if owner == dir {
+		return ""
+	}
+	return dirHashSuffix(dir)
+}
+
+// rekeyFileResult insère suffix après base dans les IDs produits par un fichier.
+func rekeyFileResult(result *fileResult, base, suffix string) {
+	rekey := func(id string) string {
+		if strings.HasPrefix(id, base) {
+			return base + suffix + id[len(base):]
+		}
+		return id
+	}
+	fragments := make(map[string]FragmentInfo, len(result.fragments))
+	for id, info := range result.fragments {
+		fragments[rekey(id)] = info
+	}
+	result.fragments = fragments
+	for ident, id := range result.declIDs {
+		result.declIDs[ident] = rekey(id)
+	}
+	if result.idClaims != nil {
+		claims := make(map[string][]IDClaim, len(result.idClaims))
+		for id, list := range result.idClaims {
+			claims[rekey(id)] = list
+		}
+		result.idClaims = claims
+	}
+}
+
+// rawLineColumn retourne la ligne et la colonne physiques (sans directives //line) d'une position.
+func (v *visitor) rawLineColumn(pos token.Pos) (int, int) {
+	position := v.fset.PositionFor(pos, false)
+	return position.Line, position.Column
+}
+
+// addFragment enregistre un fragment dont le type a été déterminé, après application des filtres.
+// Le filtre -name-filter porte sur Identifier (pour une méthode: son nom, pas le receveur).
+func (v *visitor) addFragment(fragmentID string, info FragmentInfo) {
+	if v.opts.NameFilter != nil && !v.opts.NameFilter.MatchString(info.Identifier) {
+		return
+	}
+	// Ce qu'exporte export_test.go n'est importable que par les tests: hors de l'API exportée.
+	if v.opts.ExportedOnly && (v.currentIsTestExportFile || !isExportedFragment(info, v.opts.KeepUnexportedReceivers)) {
+		v.filteredUnexported++
+		return
+	}
+	if v.currentCommentLines != nil {
+		for line := info.RawLine; line <= info.RawEndLine; line++ {
+			if v.currentCommentLines[line] {
+				info.CommentLines++
+			}
+		}
+		if total := info.RawEndLine - info.RawLine + 1; total > 0 {
+			info.CommentDensity = float64(info.CommentLines) / float64(total)
+		}
+	}
+	if v.opts.BuildContext != nil {
+		info.BuildContext = v.opts.BuildContext.GOOS + "/" + v.opts.BuildContext.GOARCH
+	}
+	info.IsGenerated = v.currentIsGenerated
+	if v.currentIsTestFile {
+		// Les tests ne font pas partie de l'API du paquet.
+		info.IsTest = true
+		info.IsTestExport = v.currentIsTestExportFile
+		info.apiSignature = ""
+		if info.FragmentType == "function" {
+			info.TestKind = testFuncKind(info.Identifier)
+		}
+	}
+	if v.idClaims != nil {
+		v.idClaims[fragmentID] = append(v.idClaims[fragmentID], IDClaim{
+			OriginalPath: info.OriginalPath,
+			Identifier:   info.Identifier,
+			FragmentType: info.FragmentType,
+			StartLine:    info.StartLine,
+		})
+	}
+	v.fragments[fragmentID] = info
+}
+
+// Méthode Visit de la structure visitor
+func (v *visitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		return nil
+	}
+	pos, endPos := node.Pos(), node.End()
+	if !pos.IsValid() || !endPos.IsValid() {
+		return v
+	}
+
+	fragmentID := ""
+	// Initialiser FragmentInfo avec les données du fichier en cours
+	info := FragmentInfo{
+		OriginalPath:        v.currentOriginalPathRel,     // Chemin du .go (ex: foo_templ.go)
+		ActualSourcePath:    v.currentActualSourcePathRel, // Chemin du .templ ou du .go
+		IsTemplSource:       v.currentIsTemplSource,
+		PackageName:         v.currentPackageName,
+		PackageDir:          path.Dir(v.currentOriginalPathRel),
+		ModulePath:          v.currentModulePath,
+		importPath:          v.currentImportPath,
+		DeprecatedByTag:     v.currentDeprecatedByTag,
+		StartLine:           v.fset.Position(pos).Line,    // Peut pointer vers le source d'une directive //line
+		EndLine:             v.fset.Position(endPos).Line, // Peut pointer vers le source d'une directive //line
+		RawLine:             v.fset.PositionFor(pos, false).Line,
+		RawEndLine:          v.fset.PositionFor(endPos, false).Line,
+		Imports:             v.currentFileImports,
+		DirectCallsInternal: []string{},
+		TypesUsedInternal:   []string{},
+	}
+
+	switch x := node.(type) {
+	case *ast.FuncDecl:
+		if x.Name == nil || x.Name.Name == "_" || x.Name.Name == "init" { // Ignorer aussi les fonctions init
+			return v
+		}
+		info.Identifier = x.Name.Name
+		info.nameLine, info.nameColumn = v.rawLineColumn(x.Name.Pos())
+		info.Docstring = getDocstring(x.Doc) // Docstring de l'AST du .go
+		info.Signature = buildSignatureString(v.fset, x, v.opts.logger())
+		info.paramCount = fieldCount(x.Type.Params)
+		if v.opts.CanonicalSignatures {
+			info.CanonicalSignature = canonicalFuncType(v.fset, x.Type)
+		}
+		if v.opts.AnalyzeImports {
+			info.ImportsUsed = importsUsedBy(x, v.currentFileImports)
+		}
+		if v.opts.CheckUnexportedResults {
+			info.resultTypeNames = localResultTypeNames(x)
+		}
+		if v.opts.APIHashes {
+			info.apiSignature = apiFuncSignature(v.fset, x)
+		}
+		if v.opts.DetectLoopCapture && !v.currentPerIterationLoopVars && x.Body != nil {
+			info.PossibleLoopVarCapture = possibleLoopVarCapture(x.Body)
+		}
+		if x.Body != nil {
+			info.callRefs = collectCallRefs(x.Body, v.currentFileImports)
+		}
+		info.typeRefs = typeRefsIn(x)
+		if v.opts.DetectLockLeaks && x.Body != nil {
+			info.PossibleLockLeak = possibleLockLeak(v.fset, x.Body)
+		}
+
+		// Construire un fragmentID basé sur OriginalPath pour l'unicité des fragments du .go
+		fragmentIDBase := v.fragmentIDBase()
+
+		if x.Recv != nil && len(x.Recv.List) > 0 {
+			info.FragmentType = "method"
+			info.ReceiverType = typeToString(v.fset, x.Recv.List[0].Type)
+			if names := x.Recv.List[0].Names; len(names) > 0 {
+				info.ReceiverName = names[0].Name
+			}
+			info.IsGeneric = receiverHasTypeParams(x.Recv.List[0].Type)
+			info.TypeParams = receiverTypeParams(x.Recv.List[0].Type)
+			info.canonicalFuncType = canonicalFuncType(v.fset, x.Type)
+			fragmentID = fmt.Sprintf("%s_%s_%s", fragmentIDBase, sanitizeIdentifier(info.ReceiverType), info.Identifier)
+			if v.opts.NormalizeReceivers {
+				// Après le calcul de l'ID, pour que les IDs ne dépendent pas de l'option.
+				info.ReceiverType, info.ReceiverIsPointer, info.ReceiverTypeParams = normalizeReceiverType(info.ReceiverType)
+			}
+		} else {
+			info.FragmentType = "function"
+			info.IsGeneric = x.Type.TypeParams != nil && len(x.Type.TypeParams.List) > 0
+			info.TypeParams = typeParamList(v.fset, x.Type.TypeParams)
+			info.IsEntrypoint = v.currentPackageName == "main" && info.Identifier == "main"
+			fragmentID = fmt.Sprintf("%s_%s", fragmentIDBase, info.Identifier)
+		}
+
+		var buf bytes.Buffer
+		if err := format.Node(&buf, v.fset, x); err == nil {
+			info.CodeDigest = v.opts.contentDigest(buf.Bytes())
+			if v.opts.FuzzyDigests {
+				info.FuzzyDigest, info.fuzzyTokens = fuzzyDigest(buf.Bytes())
+			}
+			if v.opts.ChunkLines > 0 {
+				info.ChunkDigests = chunkDigests(buf.Bytes(), v.opts.ChunkLines, v.opts.contentDigest)
+			}
+		} else {
+			v.opts.logger().Printf("Erreur digest func/meth %s: %v\n", info.Identifier, err)
+		}
+
+		if fragmentID != "" {
+			v.addFragment(fragmentID, info)
+			if _, kept := v.fragments[fragmentID]; kept {
+				v.declIDs[x.Name] = fragmentID
+			}
+		}
+		return nil // Ne pas visiter le corps de la fonction/méthode
+
+	case *ast.GenDecl:
+		if x.Tok == token.TYPE {
+			for _, spec := range x.Specs {
+				typeSpec, ok := spec.(*ast.TypeSpec)
+				if !ok || typeSpec.Name == nil || typeSpec.Name.Name == "_" || typeSpec.Type == nil {
+					continue
+				}
+				// Créer une copie de info pour ce type spécifique
+				currentTypeInfo := info
+				currentTypeInfo.FragmentType = "type"
+				currentTypeInfo.IsGeneric = typeSpec.TypeParams != nil && len(typeSpec.TypeParams.List) > 0
+				currentTypeInfo.TypeParams = typeParamList(v.fset, typeSpec.TypeParams)
+				currentTypeInfo.Identifier = typeSpec.Name.Name
+				currentTypeInfo.nameLine, currentTypeInfo.nameColumn = v.rawLineColumn(typeSpec.Name.Pos())
+				currentTypeInfo.Docstring = getDocstring(typeSpec.Doc)
+				if currentTypeInfo.Docstring == "" {
+					currentTypeInfo.Docstring = getDocstring(x.Doc)
+				}
+				if v.opts.AnalyzeImports {
+					currentTypeInfo.ImportsUsed = importsUsedBy(typeSpec, v.currentFileImports)
+				}
+				if v.opts.APIHashes {
+					currentTypeInfo.apiSignature = apiTypeSignature(v.fset, typeSpec)
+				}
+				currentTypeInfo.StartLine = v.fset.Position(typeSpec.Pos()).Line
+				currentTypeInfo.EndLine = v.fset.Position(typeSpec.End()).Line
+				currentTypeInfo.RawLine = v.fset.PositionFor(typeSpec.Pos(), false).Line
+				currentTypeInfo.RawEndLine = v.fset.PositionFor(typeSpec.End(), false).Line
+				currentTypeInfo.UnderlyingKind, currentTypeInfo.underlyingRef = underlyingKind(typeSpec.Type)
+				currentTypeInfo.typeRefs = typeRefsIn(typeSpec)
+				if structType, ok := typeSpec.Type.(*ast.StructType); ok {
+					currentTypeInfo.structFields, currentTypeInfo.structEmbeds = structMembers(structType)
+					currentTypeInfo.Fields = structFieldInfos(v.fset, structType)
+				}
+				if ifaceType, ok := typeSpec.Type.(*ast.InterfaceType); ok {
+					currentTypeInfo.isInterface = true
+					currentTypeInfo.ifaceMethods, currentTypeInfo.ifaceEmbeds = interfaceMethodSet(v.fset, ifaceType)
+					currentTypeInfo.Methods = interfaceMethodSigs(v.fset, ifaceType, v.opts.logger())
+					currentTypeInfo.EmbeddedInterfaces = currentTypeInfo.ifaceEmbeds
+				}
+
+				// Obtenir la définition formatée du type
+				tempDecl := &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{typeSpec}}
+				formattedDef := formatNode(v.fset, tempDecl)
+				if !strings.HasPrefix(formattedDef, "<!format error") {
+					currentTypeInfo.Definition = strings.TrimSpace(formattedDef)
+				} else {
+					v.opts.logger().Printf("Avertissement: Échec formatage déf type %s.\n", currentTypeInfo.Identifier)
+					currentTypeInfo.Definition = fmt.Sprintf("type %s [définition brute non formatable]", currentTypeInfo.Identifier)
+				}
+
+				currentFragmentID := fmt.Sprintf("%s_type_%s", v.fragmentIDBase(), currentTypeInfo.Identifier)
+
+				var buf bytes.Buffer
+				if err := format.Node(&buf, v.fset, typeSpec); err == nil {
+					currentTypeInfo.CodeDigest = v.opts.contentDigest(buf.Bytes())
+					if v.opts.FuzzyDigests {
+						currentTypeInfo.FuzzyDigest, currentTypeInfo.fuzzyTokens = fuzzyDigest(buf.Bytes())
+					}
+				} else {
+					v.opts.logger().Printf("Erreur digest type %s: %v\n", currentTypeInfo.Identifier, err)
+				}
+
+				if currentFragmentID != "" {
+					v.addFragment(currentFragmentID, currentTypeInfo)
+					if _, kept := v.fragments[currentFragmentID]; kept {
+						v.declIDs[typeSpec.Name] = currentFragmentID
+					}
+				}
+			}
+			return nil // Ne pas visiter les enfants du bloc de type
+		}
+		if x.Tok == token.CONST && x.Lparen.IsValid() && v.opts.GroupConstBlocks {
+			v.addConstGroup(x, info)
+			return nil
+		}
+		if x.Tok == token.CONST || x.Tok == token.VAR {
+			v.addValueSpecs(x, info)
+			return nil
+		}
+		return v
+
+	default:
+		return v
+	}
+}
+
+// addValueSpecs enregistre un fragment "constant" ou "variable" par nom déclaré au niveau du
+// paquet. Une spécification à plusieurs noms (const a, b = 1, 2) donne un fragment par nom, d'ID
+// "<base>_const_<Nom>" ou "<base>_var_<Nom>", qui partagent la même Definition et le même
+// CodeDigest (ceux de la spécification). La Definition reproduit la spécification telle
+// qu'écrite: dans un bloc à iota, une constante sans valeur reste "const B".
+func (v *visitor) addValueSpecs(decl *ast.GenDecl, info FragmentInfo) {
+	fragmentType, idPart := "constant", "const"
+	if decl.Tok == token.VAR {
+		fragmentType, idPart = "variable", "var"
+	}
+	for _, spec := range decl.Specs {
+		valueSpec, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		specInfo := info
+		specInfo.FragmentType = fragmentType
+		specInfo.Docstring = getDocstring(valueSpec.Doc)
+		if specInfo.Docstring == "" {
+			specInfo.Docstring = getDocstring(decl.Doc)
+		}
+		specInfo.StartLine = v.fset.Position(valueSpec.Pos()).Line
+		specInfo.EndLine = v.fset.Position(valueSpec.End()).Line
+		specInfo.RawLine = v.fset.PositionFor(valueSpec.Pos(), false).Line
+		specInfo.RawEndLine = v.fset.PositionFor(valueSpec.End(), false).Line
+		if v.opts.AnalyzeImports {
+			specInfo.ImportsUsed = importsUsedBy(valueSpec, v.currentFileImports)
+		}
+		// Sans Doc ni commentaire de fin de ligne, comme la Definition des types.
+		bare := *valueSpec
+		bare.Doc, bare.Comment = nil, nil
+		specInfo.Definition = strings.TrimSpace(formatNode(v.fset, &ast.GenDecl{Tok: decl.Tok, Specs: []ast.Spec{&bare}}))
+		specInfo.CodeDigest = v.opts.contentDigest([]byte(specInfo.Definition))
+		if decl.Tok == token.VAR {
+			// Hors bloc, la directive précède "var" et le parseur la rattache à la déclaration.
+			doc := valueSpec.Doc
+			if doc == nil && !decl.Lparen.IsValid() {
+				doc = decl.Doc
+			}
+			specInfo.EmbedPatterns = embedPatterns(doc)
+		}
+
+		for i, name := range valueSpec.Names {
+			if name.Name == "_" {
+				continue
+			}
+			nameInfo := specInfo
+			nameInfo.Identifier = name.Name
+			nameInfo.nameLine, nameInfo.nameColumn = v.rawLineColumn(name.Pos())
+			if v.opts.AnonStructFields && decl.Tok == token.VAR {
+				switch t := anonValueType(valueSpec, i).(type) {
+				case *ast.StructType:
+					nameInfo.Fields = anonStructFieldInfos(v.fset, t, 1)
+				case *ast.InterfaceType:
+					nameInfo.Methods = interfaceMethodSigs(v.fset, t, v.opts.logger())
+				}
+			}
+			if v.opts.APIHashes {
+				nameInfo.apiSignature = apiValueSignature(v.fset, decl.Tok, valueSpec, i)
+			}
+			fragmentID := fmt.Sprintf("%s_%s_%s", v.fragmentIDBase(), idPart, name.Name)
+			v.addFragment(fragmentID, nameInfo)
+			if _, kept := v.fragments[fragmentID]; kept {
+				v.declIDs[name] = fragmentID
+			}
+		}
+	}
+}
+
+// addConstGroup enregistre un bloc const (...) comme un seul fragment const_group, identifié
+// par sa première constante. Comme dans la spécification Go, une constante sans valeur reprend
+// le type et l'expression de la précédente: members rend ainsi lisibles les énumérations à iota.
+func (v *visitor) addConstGroup(decl *ast.GenDecl, info FragmentInfo) {
+	var members []*ast.Ident // Constantes nommées, rattachées au fragment pour -resolve-const-values
+	var typeExpr string
+	var values []ast.Expr
+	for _, spec := range decl.Specs {
+		valueSpec, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		if len(valueSpec.Values) > 0 {
+			values, typeExpr = valueSpec.Values, ""
+			if valueSpec.Type != nil {
+				typeExpr = typeToString(v.fset, valueSpec.Type)
+			}
+		}
+		doc := getDocstring(valueSpec.Doc)
+		if doc == "" {
+			doc = getDocstring(valueSpec.Comment)
+		}
+		for i, name := range valueSpec.Names {
+			member := ValueMember{Name: name.Name, Type: typeExpr, Doc: doc}
+			if i < len(values) {
+				member.Value = strings.TrimSpace(formatNode(v.fset, values[i]))
+			}
+			info.Members = append(info.Members, member)
+			if name.Name != "_" {
+				members = append(members, name)
+			}
+			if info.Identifier == "" && name.Name != "_" {
+				info.Identifier = name.Name
+				info.nameLine, info.nameColumn = v.rawLineColumn(name.Pos())
+			}
+		}
+	}
+	if info.Identifier == "" {
+		return
+	}
+	info.FragmentType = "const_group"
+	info.Docstring = getDocstring(decl.Doc)
+	block := *decl
+	block.Doc = nil // Docstring à part, comme pour les types
+	info.Definition = strings.TrimSpace(formatNode(v.fset, &block))
+	info.CodeDigest = v.opts.contentDigest([]byte(info.Definition))
+	fragmentID := fmt.Sprintf("%s_const_group_%s", v.fragmentIDBase(), info.Identifier)
+	v.addFragment(fragmentID, info)
+	if _, kept := v.fragments[fragmentID]; kept {
+		for _, name := range members {
+			v.declIDs[name] = fragmentID
+		}
+	}
+}
+
+// --- Passes post-parcours ---
+
+// basicTypeNames sont les types prédéclarés dont un type nommé a le sous-jacent "basic".
+var basicTypeNames = map[string]bool{
+	"bool": true, "string": true, "byte": true, "rune": true, "uintptr": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true, "complex64": true, "complex128": true,
+}
+
+// underlyingKind classe l'expression de type d'une déclaration. Si elle désigne un autre
+// type du paquet (type A B, type A = B, type A Set[int]), le genre est vide et ref porte
+// son nom, à résoudre après le parcours. Un type d'un autre paquet (pkg.T) reste non résolu.
+func underlyingKind(expr ast.Expr) (kind, ref string) {
+	switch t := expr.(type) {
+	case *ast.ParenExpr:
+		return underlyingKind(t.X)
+	case *ast.StructType:
+		return "struct", ""
+	case *ast.InterfaceType:
+		return "interface", ""
+	case *ast.MapType:
+		return "map", ""
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return "slice", ""
+		}
+		return "array", ""
+	case *ast.ChanType:
+		return "chan", ""
+	case *ast.FuncType:
+		return "func", ""
+	case *ast.StarExpr:
+		return "pointer", ""
+	case *ast.IndexExpr:
+		return underlyingKind(t.X)
+	case *ast.IndexListExpr:
+		return underlyingKind(t.X)
+	case *ast.Ident:
+		switch {
+		case basicTypeNames[t.Name]:
+			return "basic", ""
+		case t.Name == "error" || t.Name == "any" || t.Name == "comparable":
+			return "interface", ""
+		}
+		return "", t.Name
+	}
+	return "", ""
+}
+
+// resolveUnderlyingKinds renseigne UnderlyingKind des types définis à partir d'un autre type
+// du même paquet en suivant la chaîne de références (cycles et types absents: non résolus).
+func resolveUnderlyingKinds(fragments map[string]FragmentInfo) {
+	byName := make(map[string]FragmentInfo) // packageKey + "." + nom
+	for _, info := range fragments {
+		if info.FragmentType == "type" {
+			byName[packageKey(info)+"."+info.Identifier] = info
+		}
+	}
+	for id, info := range fragments {
+		if info.FragmentType != "type" || info.UnderlyingKind != "" || info.underlyingRef == "" {
+			continue
+		}
+		target := info
+		for steps := 0; target.UnderlyingKind == "" && target.underlyingRef != "" && steps < len(byName); steps++ {
+			next, ok := byName[packageKey(info)+"."+target.underlyingRef]
+			if !ok {
+				break
+			}
+			target = next
+		}
+		info.UnderlyingKind = target.UnderlyingKind
+		fragments[id] = info
+	}
+}
+
+// resolveReceiverConstraints complète les TypeParams des méthodes génériques avec les contraintes
+// du type receveur du même paquet, par position: (s Set[E]) reprend la contrainte du T de
+// type Set[T comparable]. Un nombre de paramètres différent ou un type absent les laisse vides.
+func resolveReceiverConstraints(fragments map[string]FragmentInfo) {
+	typeParams := make(map[string][]TypeParam) // packageKey + "." + nom du type
+	for _, info := range fragments {
+		if info.FragmentType == "type" && len(info.TypeParams) > 0 {
+			typeParams[packageKey(info)+"."+info.Identifier] = info.TypeParams
+		}
+	}
+	for id, info := range fragments {
+		if info.FragmentType != "method" || len(info.TypeParams) == 0 {
+			continue
+		}
+		declared := typeParams[packageKey(info)+"."+receiverBaseName(info.ReceiverType)]
+		if len(declared) != len(info.TypeParams) {
+			continue
+		}
+		params := make([]TypeParam, len(info.TypeParams))
+		for i, param := range info.TypeParams {
+			params[i] = TypeParam{Name: param.Name, Constraint: declared[i].Constraint}
+		}
+		info.TypeParams = params
+		fragments[id] = info
+	}
+}
+
+// findNameConflicts retourne, triés par paquet puis identifiant, les identifiants d'un même
+// paquet portés à la fois par un fragment type et un fragment function. Les méthodes sont
+// exclues: leur nom n'entre pas en conflit avec ceux du paquet.
+func findNameConflicts(fragments map[string]FragmentInfo) []NameConflict {
+	type declKey struct{ pkg, name string }
+	ids := make(map[declKey][]string)
+	kinds := make(map[declKey]map[string]bool)
+	for id, info := range fragments {
+		if info.FragmentType != "type" && info.FragmentType != "function" {
+			continue
+		}
+		key := declKey{packageKey(info), info.Identifier}
+		ids[key] = append(ids[key], id)
+		if kinds[key] == nil {
+			kinds[key] = make(map[string]bool)
+		}
+		kinds[key][info.FragmentType] = true
+	}
+	var conflicts []NameConflict
+	for key, kindSet := range kinds {
+		if len(kindSet) < 2 {
+			continue
+		}
+		sort.Strings(ids[key])
+		conflicts = append(conflicts, NameConflict{Package: key.pkg, Identifier: key.name, FragmentIDs: ids[key]})
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Package != conflicts[j].Package {
+			return conflicts[i].Package < conflicts[j].Package
+		}
+		return conflicts[i].Identifier < conflicts[j].Identifier
+	})
+	return conflicts
+}
+
+// attachFileSymbols renseigne FileSymbols de chaque fragment avec la liste triée des symboles
+// des fragments du même OriginalPath (le fragment lui-même compris). Les méthodes sont
+// nommées Type.Méthode pour distinguer les homonymes de receveurs différents.
+func attachFileSymbols(fragments map[string]FragmentInfo) {
+	symbols := make(map[string]map[string]bool)
+	for _, info := range fragments {
+		symbol := info.Identifier
+		if info.FragmentType == "method" {
+			symbol = receiverBaseName(info.ReceiverType) + "." + info.Identifier
+		}
+		if symbols[info.OriginalPath] == nil {
+			symbols[info.OriginalPath] = make(map[string]bool)
+		}
+		symbols[info.OriginalPath][symbol] = true
+	}
+	lists := make(map[string][]string, len(symbols))
+	for file, set := range symbols {
+		lists[file] = sortedKeys(set)
+	}
+	for id, info := range fragments {
+		info.FileSymbols = lists[info.OriginalPath]
+		fragments[id] = info
+	}
+}
+
+// flagOrphanedReceivers marque OrphanedReceiver les méthodes dont le nom de base du type
+// receveur ne correspond à aucun fragment type du même paquet, et retourne leurs IDs triés.
+func flagOrphanedReceivers(fragments map[string]FragmentInfo) []string {
+	types := make(map[string]bool) // packageKey + "." + nom du type
+	for _, info := range fragments {
+		if info.FragmentType == "type" {
+			types[packageKey(info)+"."+info.Identifier] = true
+		}
+	}
+	var orphans []string
+	for id, info := range fragments {
+		if info.FragmentType != "method" || types[packageKey(info)+"."+receiverBaseName(info.ReceiverType)] {
+			continue
+		}
+		info.OrphanedReceiver = true
+		fragments[id] = info
+		orphans = append(orphans, id)
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
+// maxPromotionDepth borne la profondeur d'embarquement explorée (type N struct{ *N } est valide).
+const maxPromotionDepth = 8
+
+// flagAmbiguousMethods remplit AmbiguousMethods des structs selon les règles de promotion de Go:
+// un nom est ambigu si, à la plus faible profondeur où il apparaît, plusieurs types embarqués
+// le fournissent (champ ou méthode, au moins une méthode). Les champs et méthodes de la struct
+// elle-même (profondeur 0) masquent les promotions. Seuls les types du même paquet sont résolus;
+// les interfaces embarquées fournissent leurs méthodes effectives. Retourne les IDs triés.
+func flagAmbiguousMethods(fragments map[string]FragmentInfo) []string {
+	typesByName := make(map[string]FragmentInfo) // packageKey + "." + nom du type
+	methodsByType := make(map[string][]string)   // packageKey + "." + nom du receveur -> méthodes
+	for _, info := range fragments {
+		switch info.FragmentType {
+		case "type":
+			typesByName[packageKey(info)+"."+info.Identifier] = info
+		case "method":
+			key := packageKey(info) + "." + receiverBaseName(info.ReceiverType)
+			methodsByType[key] = append(methodsByType[key], info.Identifier)
+		}
+	}
+
+	var flagged []string
+	for id, info := range fragments {
+		if info.FragmentType != "type" || len(info.structEmbeds) < 2 && !embedsStructs(info, typesByName) {
+			continue
+		}
+		pkg := packageKey(info) + "."
+		shadowed := make(map[string]bool)
+		for _, name := range info.structFields {
+			shadowed[name] = true
+		}
+		for _, name := range methodsByType[pkg+info.Identifier] {
+			shadowed[name] = true
+		}
+		ambiguous := make(map[string]bool)
+		level := info.structEmbeds
+		for depth := 1; len(level) > 0 && depth <= maxPromotionDepth; depth++ {
+			providers := make(map[string]int) // nom -> nombre de types embarqués le fournissant à cette profondeur
+			isMethod := make(map[string]bool)
+			var next []string
+			for _, typeName := range level {
+				names := make(map[string]bool)
+				for _, name := range methodsByType[pkg+typeName] {
+					names[name], isMethod[name] = true, true
+				}
+				embedded, ok := typesByName[pkg+typeName]
+				if ok && embedded.isInterface {
+					methods := embedded.effectiveMethods
+					if methods == nil {
+						methods = embedded.ifaceMethods
+					}
+					for name := range methods {
+						names[name], isMethod[name] = true, true
+					}
+				}
+				if ok {
+					for _, name := range embedded.structFields {
+						names[name] = true
+					}
+					// Pas de déduplication: un même type atteint par deux chemins est ambigu.
+					next = append(next, embedded.structEmbeds...)
+				}
+				for name := range names {
+					providers[name]++
+				}
+			}
+			for name, count := range providers {
+				if count > 1 && isMethod[name] && !shadowed[name] {
+					ambiguous[name] = true
+				}
+			}
+			for name := range providers {
+				shadowed[name] = true
+			}
+			level = next
+		}
+		if len(ambiguous) > 0 {
+			info.AmbiguousMethods = sortedKeys(ambiguous)
+			fragments[id] = info
+			flagged = append(flagged, id)
+		}
+	}
+	sort.Strings(flagged)
+	return flagged
+}
+
+// embedsStructs indique si une struct embarque au moins un type du paquet qui embarque
+// lui-même d'autres types: une ambiguïté peut alors venir d'un seul embarquement.
+func embedsStructs(info FragmentInfo, typesByName map[string]FragmentInfo) bool {
+	for _, typeName := range info.structEmbeds {
+		if len(typesByName[packageKey(info)+"."+typeName].structEmbeds) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// importCycles retourne un cycle par composante fortement connexe du graphe d'imports restreint
+// aux paquets du projet (clés de imports). Chaque cycle part de son paquet le plus petit dans
+// l'ordre lexicographique et suit le plus court chemin qui y revient; le paquet de départ n'est
+// pas répété à la fin. Les cycles sont triés par premier paquet.
+func importCycles(imports map[string]map[string]bool) [][]string {
+	graph := make(map[string][]string, len(imports))
+	for pkg, deps := range imports {
+		for dep := range deps {
+			if _, ok := imports[dep]; ok {
+				graph[pkg] = append(graph[pkg], dep)
+			}
+		}
+		sort.Strings(graph[pkg])
+	}
+	nodes := make([]string, 0, len(imports))
+	for pkg := range imports {
+		nodes = append(nodes, pkg)
+	}
+	sort.Strings(nodes)
+
+	// Tarjan: composantes fortement connexes.
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var components [][]string
+	var strongConnect func(pkg string)
+	strongConnect = func(pkg string) {
+		index[pkg] = len(index)
+		lowlink[pkg] = index[pkg]
+		stack = append(stack, pkg)
+		onStack[pkg] = true
+		for _, dep := range graph[pkg] {
+			if _, seen := index[dep]; !seen {
+				strongConnect(dep)
+				if lowlink[dep] < lowlink[pkg] {
+					lowlink[pkg] = lowlink[dep]
+				}
+			} else if onStack[dep] && index[dep] < lowlink[pkg] {
+				lowlink[pkg] = index[dep]
+			}
+		}
+		if lowlink[pkg] != index[pkg] {
+			return
+		}
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == pkg {
+				break
+			}
+		}
+		components = append(components, component)
+	}
+	for _, pkg := range nodes {
+		if _, seen := index[pkg]; !seen {
+			strongConnect(pkg)
+		}
+	}
+
+	var cycles [][]string
+	for _, component := range components {
+		members := make(map[string]bool, len(component))
+		for _, pkg := range component {
+			members[pkg] = true
+		}
+		sort.Strings(component)
+		start := component[0]
+		if len(component) == 1 && !imports[start][start] {
+			continue
+		}
+		// Plus court chemin start -> start dans la composante (parcours en largeur).
+		parent := map[string]string{}
+		queue := []string{start}
+		for len(queue) > 0 && parent[start] == "" {
+			pkg := queue[0]
+			queue = queue[1:]
+			for _, dep := range graph[pkg] {
+				if _, seen := parent[dep]; !seen && members[dep] {
+					parent[dep] = pkg
+					queue = append(queue, dep)
+				}
+			}
+		}
+		cycle := []string{}
+		for pkg := parent[start]; pkg != start; pkg = parent[pkg] {
+			cycle = append([]string{pkg}, cycle...)
+		}
+		cycles = append(cycles, append([]string{start}, cycle...))
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+// renderDocstrings remplit DocstringHTML avec le rendu HTML de Docstring par go/doc/comment.
+// Les liens [Nom] et [Type.Méthode] sont résolus parmi les fragments du même paquet (ancres
+// "#Nom"), les liens [pkg.Nom] vers pkg.go.dev.
+func renderDocstrings(fragments map[string]FragmentInfo) {
+	symbols := make(map[string]bool) // packageKey + "." + nom, ou + "." + receveur + "." + méthode
+	for _, info := range fragments {
+		if info.FragmentType == "method" {
+			symbols[packageKey(info)+"."+receiverBaseName(info.ReceiverType)+"."+info.Identifier] = true
+		} else {
+			symbols[packageKey(info)+"."+info.Identifier] = true
+		}
+	}
+	printer := &comment.Printer{DocLinkBaseURL: "https://pkg.go.dev"}
+	for id, info := range fragments {
+		if info.Docstring == "" {
+			continue
+		}
+		pkg := packageKey(info)
+		parser := &comment.Parser{
+			LookupSym: func(recv, name string) bool {
+				if recv == "" {
+					return symbols[pkg+"."+name]
+				}
+				return symbols[pkg+"."+recv+"."+name]
+			},
+		}
+		info.DocstringHTML = string(printer.HTML(parser.Parse(info.Docstring)))
+		fragments[id] = info
+	}
+}
+
+// collectEntrypoints retourne les IDs triés des fragments marqués IsEntrypoint.
+func collectEntrypoints(fragments map[string]FragmentInfo) []string {
+	var entrypoints []string
+	for id, info := range fragments {
+		if info.IsEntrypoint {
+			entrypoints = append(entrypoints, id)
+		}
+	}
+	sort.Strings(entrypoints)
+	return entrypoints
+}
+
+// resolveEffectiveMethods calcule EffectiveMethods pour chaque interface: ses méthodes explicites
+// plus celles promues (transitivement) par les interfaces du projet qu'elle embarque.
+// Un élément embarqué est résolu par son nom dans le même paquet; les interfaces externes
+// (ex: io.Reader) et les contraintes de type ne sont pas résolues et rendent l'ensemble incomplet.
+// Les cycles d'embarquement (invalides en Go) sont ignorés sans boucler.
+func resolveEffectiveMethods(fragments map[string]FragmentInfo) {
+	ifaceIDs := make(map[string]string) // paquet + nom d'interface -> ID du fragment
+	for id, info := range fragments {
+		if info.isInterface {
+			ifaceIDs[packageKey(info)+"."+info.Identifier] = id
+		}
+	}
+
+	for id, info := range fragments {
+		if !info.isInterface {
+			continue
+		}
+		methods := make(map[string]string)
+		complete := collectInterfaceMethods(fragments, ifaceIDs, id, make(map[string]bool), methods)
+		names := make([]string, 0, len(methods))
+		for name := range methods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		info.EffectiveMethods = names
+		info.effectiveMethods = methods
+		info.effectiveComplete = complete
+		fragments[id] = info
+	}
+}
+
+// collectInterfaceMethods ajoute à methods les méthodes de l'interface id et de ses interfaces
+// embarquées. Retourne false si un élément embarqué n'a pas pu être résolu.
+func collectInterfaceMethods(fragments map[string]FragmentInfo, ifaceIDs map[string]string, id string, visited map[string]bool, methods map[string]string) bool {
+	if visited[id] {
+		return true // Déjà collectée (embarquement en losange ou cycle)
+	}
+	visited[id] = true
+	info := fragments[id]
+	for name, sig := range info.ifaceMethods {
+		methods[name] = sig
+	}
+	complete := true
+	for _, embed := range info.ifaceEmbeds {
+		embedID, ok := ifaceIDs[packageKey(info)+"."+receiverBaseName(embed)]
+		if !ok {
+			complete = false
+			continue
+		}
+		if !collectInterfaceMethods(fragments, ifaceIDs, embedID, visited, methods) {
+			complete = false
+		}
+	}
+	return complete
+}
+
+// resolveImplementations renseigne ImplementedBy sur chaque fragment d'interface avec les IDs
+// des types du projet dont l'ensemble de méthodes (celui de *T) la satisfait.
+// La correspondance est purement structurelle, sur les données parsées: nom de méthode et
+// type de fonction canonique (types comparés textuellement). Limitations connues:
+//   - les types externes au projet ne sont pas considérés;
+//   - les méthodes promues par embarquement (en particulier via des types externes) sont ignorées;
+//   - l'ensemble de méthodes effectif de l'interface est utilisé (cf. resolveEffectiveMethods);
+//     les interfaces embarquant un élément non résolu (interface externe, contrainte) sont ignorées;
+//   - les interfaces vides sont ignorées (tout type les satisfait);
+//   - entre paquets, un type nommé localement (ex: Foo vs pkg.Foo) ne correspond pas.
+func resolveImplementations(fragments map[string]FragmentInfo) {
+	// Ensemble de méthodes par type, indexé par paquet + nom de base du receveur.
+	methodSets := make(map[string]map[string]string)
+	for _, info := range fragments {
+		if info.FragmentType != "method" {
+			continue
+		}
+		key := packageKey(info) + "." + receiverBaseName(info.ReceiverType)
+		if methodSets[key] == nil {
+			methodSets[key] = make(map[string]string)
+		}
+		methodSets[key][info.Identifier] = info.canonicalFuncType
+	}
+
+	for ifaceID, iface := range fragments {
+		if !iface.isInterface || !iface.effectiveComplete || len(iface.effectiveMethods) == 0 {
+			continue
+		}
+		var implementedBy []string
+		for typeID, t := range fragments {
+			if t.FragmentType != "type" || t.isInterface {
+				continue
+			}
+			samePackage := packageKey(t) == packageKey(iface)
+			methods := methodSets[packageKey(t)+"."+t.Identifier]
+			if methodSetSatisfies(methods, iface.effectiveMethods, samePackage) {
+				implementedBy = append(implementedBy, typeID)
+			}
+		}
+		sort.Strings(implementedBy)
+		iface.ImplementedBy = implementedBy
+		fragments[ifaceID] = iface
+	}
+}
+
+// aggregatePackages crée une entrée PackageInfo (cartes initialisées) pour chaque paquet ayant des fragments.
+func aggregatePackages(fragments map[string]FragmentInfo) map[string]PackageInfo {
+	packages := make(map[string]PackageInfo)
+	for _, info := range fragments {
+		key := packageKey(info)
+		if _, ok := packages[key]; !ok {
+			packages[key] = PackageInfo{
+				Name:        info.PackageName,
+				Dir:         info.PackageDir,
+				ImportUsage: make(map[string]int),
+			}
+		}
+	}
+	return packages
+}
+
+// computePackageDigests renseigne PackageDigest: digest (-digest) de la liste triée des CodeDigest des
+// fragments du paquet. Le tri rend le digest indépendant de l'ordre de parcours.
+func computePackageDigests(fragments map[string]FragmentInfo, packages map[string]PackageInfo, digest func([]byte) string) {
+	digests := make(map[string][]string)
+	for _, info := range fragments {
+		key := packageKey(info)
+		digests[key] = append(digests[key], info.CodeDigest)
+	}
+	for key, pkg := range packages {
+		list := digests[key]
+		sort.Strings(list)
+		pkg.PackageDigest = digest([]byte(strings.Join(list, "\n")))
+		packages[key] = pkg
+	}
+}
+
+// keepChangedPackages réduit le manifeste aux paquets nouveaux ou dont le PackageDigest diffère
+// de celui de baseline: seuls leurs fragments, entrées Packages, points d'entrée, conflits de noms
+// et données par fichier restent. Les paquets inchangés sont listés dans UnchangedPackages avec
+// leur digest, ceux de baseline absents de l'analyse dans RemovedPackages. Un paquet de baseline
+// sans package_digest est considéré modifié.
+func keepChangedPackages(manifest *FragmentManifest, baseline FragmentManifest) {
+	changedDirs := make(map[string]bool)
+	manifest.UnchangedPackages = make(map[string]string)
+	for key, pkg := range manifest.Packages {
+		if old, ok := baseline.Packages[key]; ok && old.PackageDigest != "" && old.PackageDigest == pkg.PackageDigest {
+			manifest.UnchangedPackages[key] = pkg.PackageDigest
+			delete(manifest.Packages, key)
+			continue
+		}
+		changedDirs[pkg.Dir] = true
+	}
+	for key := range baseline.Packages {
+		if _, ok := manifest.Packages[key]; !ok && manifest.UnchangedPackages[key] == "" {
+			manifest.RemovedPackages = append(manifest.RemovedPackages, key)
+		}
+	}
+	sort.Strings(manifest.RemovedPackages)
+
+	for id, info := range manifest.Fragments {
+		if _, changed := manifest.Packages[packageKey(info)]; !changed {
+			delete(manifest.Fragments, id)
+		}
+	}
+	entrypoints := manifest.Entrypoints[:0]
+	for _, id := range manifest.Entrypoints {
+		if _, ok := manifest.Fragments[id]; ok {
+			entrypoints = append(entrypoints, id)
+		}
+	}
+	manifest.Entrypoints = entrypoints
+	conflicts := manifest.NameConflicts[:0]
+	for _, conflict := range manifest.NameConflicts {
+		if _, changed := manifest.Packages[conflict.Package]; changed {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	manifest.NameConflicts = conflicts
+	inChangedDir := func(file string) bool { return changedDirs[path.Dir(file)] }
+	for file := range manifest.FileModTimes {
+		if !inChangedDir(file) {
+			delete(manifest.FileModTimes, file)
+		}
+	}
+	for file := range manifest.FileHeaders {
+		if !inChangedDir(file) {
+			delete(manifest.FileHeaders, file)
+		}
+	}
+	for file := range manifest.FileStats {
+		if !inChangedDir(file) {
+			delete(manifest.FileStats, file)
+		}
+	}
+	for file := range manifest.FileDigests {
+		if !inChangedDir(file) {
+			delete(manifest.FileDigests, file)
+		}
+	}
+}
+
+// computePublicAPIHashes renseigne PublicAPIHash: digest (-digest) de la liste triée des signatures
+// d'API (apiSignature) des fragments exportés du paquet. Corps, commentaires, noms de
+// paramètres et champs non exportés n'y entrent pas: le hash ne change qu'avec l'API publique.
+func computePublicAPIHashes(fragments map[string]FragmentInfo, packages map[string]PackageInfo, digest func([]byte) string) {
+	signatures := make(map[string][]string)
+	for _, info := range fragments {
+		if info.apiSignature == "" {
+			continue
+		}
+		key := packageKey(info)
+		signatures[key] = append(signatures[key], info.apiSignature)
+	}
+	for key, pkg := range packages {
+		list := signatures[key]
+		sort.Strings(list)
+		pkg.PublicAPIHash = digest([]byte(strings.Join(list, "\n")))
+		packages[key] = pkg
+	}
+}
+
+// flagLongFunctions marque TooLong les fonctions et méthodes dont EndLine - StartLine dépasse
+// maxLines et retourne leurs IDs triés.
+func flagLongFunctions(fragments map[string]FragmentInfo, maxLines int) []string {
+	var long []string
+	for id, info := range fragments {
+		if info.FragmentType != "function" && info.FragmentType != "method" {
+			continue
+		}
+		if info.EndLine-info.StartLine > maxLines {
+			info.TooLong = true
+			fragments[id] = info
+			long = append(long, id)
+		}
+	}
+	sort.Strings(long)
+	return long
+}
+
+// enrichFragments appelle command (via le shell) pour chaque fragment, au plus jobs à la fois,
+// avec le fragment et son id en JSON sur stdin. La sortie doit être un objet JSON, dont les
+// clés sont fusionnées dans Extra. Un échec (code de sortie non nul, sortie invalide) est
+// signalé sur stderr et laisse le fragment inchangé; retourne le nombre d'échecs.
+func enrichFragments(fragments map[string]FragmentInfo, command string, jobs int, logger Logger) int {
+	if jobs < 1 {
+		jobs = 1
+	}
+	type result struct {
+		id    string
+		extra map[string]interface{}
+	}
+	ids := make(chan string)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				extra, err := runEnrichCommand(command, FragmentEntry{ID: id, FragmentInfo: fragments[id]})
+				if err != nil {
+					logger.Printf("Avertissement: -enrich-cmd échoué pour %s: %v\n", id, err)
+				}
+				results <- result{id: id, extra: extra}
+			}
+		}()
+	}
+	go func() {
+		for _, id := range sortedFragmentIDs(fragments) {
+			ids <- id
+		}
+		close(ids)
+		wg.Wait()
+		close(results)
+	}()
+
+	var collected []result
+	failed := 0
+	for r := range results {
+		if r.extra == nil {
+			failed++
+			continue
+		}
+		collected = append(collected, r)
+	}
+	// Les workers lisent fragments sans verrou: la table n'est modifiée qu'une fois tous terminés.
+	for _, r := range collected {
+		info := fragments[r.id]
+		if info.Extra == nil {
+			info.Extra = make(map[string]interface{}, len(r.extra))
+		}
+		for k, v := range r.extra {
+			info.Extra[k] = v
+		}
+		fragments[r.id] = info
+	}
+	return failed
+}
+
+// runEnrichCommand exécute command avec entry en JSON sur stdin et décode l'objet JSON de stdout.
+func runEnrichCommand(command string, entry FragmentEntry) (map[string]interface{}, error) {
+	input, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var extra map[string]interface{}
+	if err := json.Unmarshal(output, &extra); err != nil {
+		return nil, fmt.Errorf("sortie JSON invalide: %v", err)
+	}
+	if extra == nil {
+		extra = map[string]interface{}{}
+	}
+	return extra, nil
+}
+
+// sortedFragmentIDs retourne les IDs des fragments triés.
+func sortedFragmentIDs(fragments map[string]FragmentInfo) []string {
+	ids := make([]string, 0, len(fragments))
+	for id := range fragments {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// internImports rassemble les imports distincts des fragments dans manifest.ImportTable,
+// triée par chemin puis alias, et remplace Imports de chaque fragment par ImportRefs, les
+// indices correspondants dans le même ordre. La liste d'un fragment se reconstruit par
+// ImportTable[i] pour chaque i de ImportRefs.
+func internImports(manifest *FragmentManifest) {
+	unique := make(map[ImportInfo]bool)
+	for _, info := range manifest.Fragments {
+		for _, imp := range info.Imports {
+			unique[imp] = true
+		}
+	}
+	table := make([]ImportInfo, 0, len(unique))
+	for imp := range unique {
+		table = append(table, imp)
+	}
+	sort.Slice(table, func(i, j int) bool {
+		if table[i].Path != table[j].Path {
+			return table[i].Path < table[j].Path
+		}
+		return table[i].Name < table[j].Name
+	})
+	index := make(map[ImportInfo]int, len(table))
+	for i, imp := range table {
+		index[imp] = i
+	}
+	for id, info := range manifest.Fragments {
+		if len(info.Imports) == 0 {
+			continue
+		}
+		info.ImportRefs = make([]int, len(info.Imports))
+		for i, imp := range info.Imports {
+			info.ImportRefs[i] = index[imp]
+		}
+		info.Imports = nil
+		manifest.Fragments[id] = info
+	}
+	manifest.ImportTable = table
+}
+
+// qualifiedName retourne le nom qualifié Go d'un fragment: "chemin/import.Nom" pour les
+// fonctions et types, "chemin/import.Type.Méthode" pour les méthodes.
+func qualifiedName(info FragmentInfo) string {
+	if info.FragmentType == "method" {
+		return info.importPath + "." + receiverBaseName(info.ReceiverType) + "." + info.Identifier
+	}
+	return info.importPath + "." + info.Identifier
+}
+
+// rekeyByQualifiedName remplace les IDs synthétiques du manifeste par les noms qualifiés des
+// fragments, y compris dans les références entre fragments (appels, implémentations,
+// points d'entrée, conflits de noms). Les fragments partageant un même nom qualifié (variantes par build tags,
+// paquets homonymes d'un même dossier) reçoivent tous le suffixe "@" + OriginalPath.
+func rekeyByQualifiedName(manifest *FragmentManifest) {
+	byName := make(map[string][]string)
+	for id, info := range manifest.Fragments {
+		name := qualifiedName(info)
+		byName[name] = append(byName[name], id)
+	}
+	newIDs := make(map[string]string, len(manifest.Fragments))
+	for name, ids := range byName {
+		if len(ids) == 1 {
+			newIDs[ids[0]] = name
+			continue
+		}
+		for _, id := range ids {
+			newIDs[id] = name + "@" + manifest.Fragments[id].OriginalPath
+		}
+	}
+	rename := func(ids []string) []string {
+		if ids == nil {
+			return nil
+		}
+		renamed := make([]string, len(ids))
+		for i, id := range ids {
+			if newID, ok := newIDs[id]; ok {
+				id = newID
+			}
+			renamed[i] = id
+		}
+		return renamed
+	}
+
+	fragments := make(map[string]FragmentInfo, len(manifest.Fragments))
+	for id, info := range manifest.Fragments {
+		info.DirectCallsInternal = rename(info.DirectCallsInternal)
+		info.DirectCallsSamePackage = rename(info.DirectCallsSamePackage)
+		info.DirectCallsCrossPackage = rename(info.DirectCallsCrossPackage)
+		info.TypesUsedInternal = rename(info.TypesUsedInternal)
+		info.ImplementedBy = rename(info.ImplementedBy)
+		fragments[newIDs[id]] = info
+	}
+	manifest.Fragments = fragments
+	manifest.Entrypoints = rename(manifest.Entrypoints)
+	sort.Strings(manifest.Entrypoints)
+	for i := range manifest.NameConflicts {
+		manifest.NameConflicts[i].FragmentIDs = rename(manifest.NameConflicts[i].FragmentIDs)
+	}
+}
+
+// localResultTypeNames retourne les identifiants non qualifiés cités dans les types des
+// résultats de fd (ex: "node" dans "([]*node, error)"), hors paramètres de type de la
+// fonction ou du receveur. Les types qualifiés (pkg.T) sont ignorés: ils ne sont jamais
+// non exportés du point de vue de l'appelant.
+func localResultTypeNames(fd *ast.FuncDecl) []string {
+	if fd.Type.Results == nil {
+		return nil
+	}
+	typeParams := make(map[string]bool)
+	if fd.Type.TypeParams != nil {
+		for _, field := range fd.Type.TypeParams.List {
+			for _, name := range field.Names {
+				typeParams[name.Name] = true
+			}
+		}
+	}
+	if fd.Recv != nil && len(fd.Recv.List) > 0 {
+		recv := fd.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv = star.X
+		}
+		switch r := recv.(type) {
+		case *ast.IndexExpr:
+			if id, ok := r.Index.(*ast.Ident); ok {
+				typeParams[id.Name] = true
+			}
+		case *ast.IndexListExpr:
+			for _, index := range r.Indices {
+				if id, ok := index.(*ast.Ident); ok {
+					typeParams[id.Name] = true
+				}
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	var names []string
+	ast.Inspect(fd.Type.Results, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			return false
+		case *ast.Field:
+			// Ne visiter que le type: les noms de résultats ne sont pas des types.
+			ast.Inspect(x.Type, func(n ast.Node) bool {
+				if _, ok := n.(*ast.SelectorExpr); ok {
+					return false
+				}
+				if id, ok := n.(*ast.Ident); ok && !typeParams[id.Name] && !seen[id.Name] {
+					seen[id.Name] = true
+					names = append(names, id.Name)
+				}
+				return true
+			})
+			return false
+		}
+		return true
+	})
+	return names
+}
+
+// flagUnexportedResults marque LeaksUnexportedType les fonctions et méthodes exportées
+// (receveur exporté pour les méthodes) dont un résultat cite un type non exporté déclaré
+// comme fragment type dans le même paquet, et retourne leurs IDs triés. Un type local
+// absent du manifeste (filtré, ou déclaré dans une fonction) n'est pas pris en compte.
+func flagUnexportedResults(fragments map[string]FragmentInfo) []string {
+	unexportedTypes := make(map[string]bool) // packageKey + "." + nom
+	for _, info := range fragments {
+		if info.FragmentType == "type" && !ast.IsExported(info.Identifier) {
+			unexportedTypes[packageKey(info)+"."+info.Identifier] = true
+		}
+	}
+	var leaks []string
+	for id, info := range fragments {
+		if (info.FragmentType != "function" && info.FragmentType != "method") || !ast.IsExported(info.Identifier) {
+			continue
+		}
+		if info.FragmentType == "method" && !ast.IsExported(receiverBaseName(info.ReceiverType)) {
+			continue
+		}
+		for _, name := range info.resultTypeNames {
+			if unexportedTypes[packageKey(info)+"."+name] {
+				info.LeaksUnexportedType = true
+				fragments[id] = info
+				leaks = append(leaks, id)
+				break
+			}
+		}
+	}
+	sort.Strings(leaks)
+	return leaks
+}
+
+// fieldCount retourne le nombre d'éléments d'une liste de paramètres, les noms groupés
+// (a, b int) comptant chacun et un paramètre sans nom comptant pour un.
+func fieldCount(fields *ast.FieldList) int {
+	if fields == nil {
+		return 0
+	}
+	n := 0
+	for _, field := range fields.List {
+		if len(field.Names) == 0 {
+			n++
+		} else {
+			n += len(field.Names)
+		}
+	}
+	return n
+}
+
+// flagTooManyParams marque TooManyParams les fonctions et méthodes de plus de maxParams
+// paramètres et retourne leurs IDs triés.
+func flagTooManyParams(fragments map[string]FragmentInfo, maxParams int) []string {
+	var many []string
+	for id, info := range fragments {
+		if info.FragmentType != "function" && info.FragmentType != "method" {
+			continue
+		}
+		if info.paramCount > maxParams {
+			info.TooManyParams = true
+			fragments[id] = info
+			many = append(many, id)
+		}
+	}
+	sort.Strings(many)
+	return many
+}
+
+// flagUndocumented marque Undocumented les fragments exportés sans Docstring et retourne
+// leurs IDs triés ainsi que le nombre total de fragments exportés. Une méthode n'est
+// considérée exportée que si son type receveur l'est aussi.
+func flagUndocumented(fragments map[string]FragmentInfo) ([]string, int) {
+	var undocumented []string
+	exported := 0
+	for id, info := range fragments {
+		if !ast.IsExported(info.Identifier) || info.IsTest {
+			continue
+		}
+		if info.FragmentType == "method" && !ast.IsExported(receiverBaseName(info.ReceiverType)) {
+			continue
+		}
+		exported++
+		if strings.TrimSpace(info.Docstring) == "" {
+			info.Undocumented = true
+			fragments[id] = info
+			undocumented = append(undocumented, id)
+		}
+	}
+	sort.Strings(undocumented)
+	return undocumented, exported
+}
+
+// idCollisions retourne, triés par ID, les IDs revendiqués par plusieurs déclarations.
+func idCollisions(claims map[string][]IDClaim) []IDCollision {
+	collisions := []IDCollision{}
+	for id, list := range claims {
+		if len(list) > 1 {
+			collisions = append(collisions, IDCollision{ID: id, Claims: list})
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i].ID < collisions[j].ID })
+	return collisions
+}
+
+// findDuplicates regroupe les fragments par CodeDigest et retourne les groupes d'au moins deux
+// fragments, triés par digest. Le digest portant sur le code formaté (nom compris), seuls les
+// fragments strictement identiques sont regroupés, par exemple un helper copié dans plusieurs paquets.
+func findDuplicates(fragments map[string]FragmentInfo) []DuplicateCluster {
+	byDigest := make(map[string][]string)
+	for id, info := range fragments {
+		if info.CodeDigest != "" {
+			byDigest[info.CodeDigest] = append(byDigest[info.CodeDigest], id)
+		}
+	}
+	clusters := []DuplicateCluster{}
+	for digest, ids := range byDigest {
+		if len(ids) < 2 {
+			continue
+		}
+		sort.Strings(ids)
+		clusters = append(clusters, DuplicateCluster{CodeDigest: digest, FragmentIDs: ids})
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].CodeDigest < clusters[j].CodeDigest })
+	return clusters
+}
+
+// groupMethodsByName regroupe les fragments méthode par Identifier, quel que soit le
+// receveur. Chaque groupe est trié par dossier de paquet, receveur puis ID.
+func groupMethodsByName(fragments map[string]FragmentInfo) map[string][]MethodGroupEntry {
+	groups := make(map[string][]MethodGroupEntry)
+	for id, info := range fragments {
+		if info.FragmentType != "method" {
+			continue
+		}
+		groups[info.Identifier] = append(groups[info.Identifier], MethodGroupEntry{
+			ReceiverType: info.ReceiverType,
+			PackageDir:   info.PackageDir,
+			FragmentID:   id,
+		})
+	}
+	for _, entries := range groups {
+		sort.Slice(entries, func(i, j int) bool {
+			a, b := entries[i], entries[j]
+			if a.PackageDir != b.PackageDir {
+				return a.PackageDir < b.PackageDir
+			}
+			if a.ReceiverType != b.ReceiverType {
+				return a.ReceiverType < b.ReceiverType
+			}
+			return a.FragmentID < b.FragmentID
+		})
+	}
+	return groups
+}
+
+// chunkDigests découpe le code formaté src en blocs consécutifs de n lignes et retourne le
+// digest (-digest) de chacun, ou nil si src ne dépasse pas n lignes. Une modification locale ne change
+// que le digest de son bloc, tant qu'elle ne modifie pas le nombre de lignes.
+func chunkDigests(src []byte, n int, digest func([]byte) string) []string {
+	lines := strings.SplitAfter(strings.TrimRight(string(src), "\n"), "\n")
+	if len(lines) <= n {
+		return nil
+	}
+	var digests []string
+	for start := 0; start < len(lines); start += n {
+		end := start + n
+		if end > len(lines) {
+			end = len(lines)
+		}
+		digests = append(digests, digest([]byte(strings.Join(lines[start:end], ""))))
+	}
+	return digests
+}
+
+// fuzzyShingle est le nombre de jetons consécutifs hachés ensemble par fuzzyDigest.
+const fuzzyShingle = 3
+
+// minFuzzyTokens est le nombre minimal de jetons pour qu'un fragment participe à -find-similar:
+// sur du code très court, les SimHash se ressemblent trop pour être significatifs.
+const minFuzzyTokens = 30
+
+// fuzzyDigest calcule un SimHash 64 bits du code formaté src: le flux de jetons Go est
+// normalisé (identifiants -> ID, littéraux -> leur genre, commentaires ignorés), découpé en
+// séquences de fuzzyShingle jetons hachées FNV-1a, puis chaque bit du digest prend la
+// majorité des bits des séquences. Un renommage de variable ne change pas le digest; une
+// modification locale n'en change que quelques bits. Retourne aussi le nombre de jetons.
+func fuzzyDigest(src []byte) (string, int) {
+	var s scanner.Scanner
+	file := token.NewFileSet().AddFile("", -1, len(src))
+	s.Init(file, src, nil, 0)
+	var tokens []string
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		switch {
+		case tok == token.IDENT:
+			tokens = append(tokens, "ID")
+		case tok.IsLiteral():
+			tokens = append(tokens, tok.String())
+		case tok == token.SEMICOLON && lit == "\n":
+			// Point-virgule implicite de fin de ligne: ignoré pour ne pas dépendre de la mise en forme.
+		default:
+			tokens = append(tokens, tok.String())
+		}
+	}
+
+	var weights [64]int
+	for i := 0; i+fuzzyShingle <= len(tokens) || (i == 0 && len(tokens) > 0); i++ {
+		end := i + fuzzyShingle
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		h := uint64(14695981039346656037) // FNV-1a 64 bits
+		for _, t := range tokens[i:end] {
+			for j := 0; j < len(t); j++ {
+				h ^= uint64(t[j])
+				h *= 1099511628211
+			}
+			h ^= ' '
+			h *= 1099511628211
+		}
+		for bit := 0; bit < 64; bit++ {
+			if h&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var digest uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			digest |= 1 << uint(bit)
+		}
+	}
+	return fmt.Sprintf("%016x", digest), len(tokens)
+}
+
+// fuzzySimilarity retourne la similarité de deux FuzzyDigest: 1 - distance de Hamming / 64.
+func fuzzySimilarity(a, b uint64) float64 {
+	return 1 - float64(bits.OnesCount64(a^b))/64
+}
+
+// findSimilar regroupe les fragments d'au moins minFuzzyTokens jetons dont le FuzzyDigest a
+// une similarité >= threshold avec un autre membre du groupe (fermeture transitive), et
+// retourne les groupes d'au moins deux fragments. Les fragments strictement identiques
+// (même CodeDigest) sont inclus; -find-duplicates les isole. Comparaison de toutes les paires.
+func findSimilar(fragments map[string]FragmentInfo, threshold float64) []SimilarCluster {
+	var ids []string
+	var digests []uint64
+	for id, info := range fragments {
+		if info.FuzzyDigest == "" || info.fuzzyTokens < minFuzzyTokens {
+			continue
+		}
+		var d uint64
+		if _, err := fmt.Sscanf(info.FuzzyDigest, "%x", &d); err != nil {
+			continue
+		}
+		ids = append(ids, id)
+		digests = append(digests, d)
+	}
+
+	parent := make([]int, len(ids))
+	minSim := make([]float64, len(ids))
+	for i := range parent {
+		parent[i] = i
+		minSim[i] = 1
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range ids {
+		for j := i + 1; j < len(ids); j++ {
+			sim := fuzzySimilarity(digests[i], digests[j])
+			if sim < threshold {
+				continue
+			}
+			ri, rj := find(i), find(j)
+			if ri != rj {
+				parent[rj] = ri
+				if minSim[rj] < minSim[ri] {
+					minSim[ri] = minSim[rj]
+				}
+			}
+			if sim < minSim[ri] {
+				minSim[ri] = sim
+			}
+		}
+	}
+
+	groups := make(map[int][]string)
+	for i, id := range ids {
+		root := find(i)
+		groups[root] = append(groups[root], id)
+	}
+	clusters := []SimilarCluster{}
+	for root, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		sort.Strings(members)
+		clusters = append(clusters, SimilarCluster{FragmentIDs: members, MinSimilarity: minSim[root]})
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].FragmentIDs[0] < clusters[j].FragmentIDs[0] })
+	return clusters
+}
+
+// methodSetSatisfies indique si methods contient toutes les méthodes requises.
+// Une méthode non exportée ne peut être satisfaite que depuis le même paquet.
+func methodSetSatisfies(methods, required map[string]string, samePackage bool) bool {
+	for name, sig := range required {
+		if !samePackage && !ast.IsExported(name) {
+			return false
+		}
+		if got, ok := methods[name]; !ok || got != sig {
+			return false
+		}
+	}
+	return true
+}
+
+// --- Vérification de types (-type-check) ---
+
+// typeCheckPackage est un paquet du projet vérifié par go/types (chargé par go/packages).
+type typeCheckPackage struct {
+	importPath string
+	files      []*ast.File
+	pkg        *types.Package
+	info       *types.Info
+	errCount   int // Erreurs du paquet (chargement, syntaxe, types)
+}
+
+// typeCheckProject charge et vérifie avec go/packages les paquets des répertoires des fichiers
+// parsés, depuis rootDir (le go.mod qui le contient donne le module principal). Les fichiers
+// déjà parsés par le parcours sont réutilisés tels quels (Config.ParseFile), pour que les
+// identifiants de declIDs soient ceux que go/types renseigne. Les dépendances hors projet sont
+// vérifiées depuis leurs sources (NeedDeps) plutôt que lues depuis leurs données d'export,
+// dont le format suit la version de Go et peut être illisible pour la version de x/tools.
+// Avec des fichiers _test.go (-detect-untested), chaque paquet est remplacé par sa variante
+// de test, qui contient aussi ses fichiers ordinaires.
+// Un paquet en erreur (types, syntaxe, répertoire hors module) garde ses informations
+// partielles et compte ses erreurs: les appels résolus par noms y sont conservés (cf.
+// resolveCallsWithTypes). Les fichiers écartés par go list (contraintes de build du GOOS/GOARCH
+// courant ou de -build-tags) ne sont pas vérifiés. Si le chargement échoue (pas de go.mod,
+// commande go absente), aucun paquet n'est retourné.
+func typeCheckProject(fset *token.FileSet, files []parsedFile, rootDir string, buildContext *build.Context, logger Logger) []*typeCheckPackage {
+	parsed := make(map[string]*ast.File, len(files))
+	seenDirs := make(map[string]bool)
+	var patterns []string
+	tests := false
+	for _, f := range files {
+		filename := fset.Position(f.node.Package).Filename
+		parsed[filename] = f.node
+		if dir := filepath.Dir(filename); !seenDirs[dir] {
+			seenDirs[dir] = true
+			patterns = append(patterns, dir)
+		}
+		tests = tests || strings.HasSuffix(filename, "_test.go")
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	cfg := &packages.Config{
+		Mode:  packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax,
+		Dir:   rootDir,
+		Fset:  fset,
+		Tests: tests,
+		ParseFile: func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+			if node, ok := parsed[filename]; ok {
+				return node, nil
+			}
+			return parser.ParseFile(fset, filename, src, parser.ParseComments)
+		},
+	}
+	if buildContext != nil {
+		cfg.BuildFlags = []string{"-tags=" + strings.Join(buildContext.BuildTags, ",")}
+		cfg.Env = append(os.Environ(), "GOOS="+buildContext.GOOS, "GOARCH="+buildContext.GOARCH)
+	}
+	loaded, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		logger.Printf("Avertissement: chargement des paquets impossible (%v), appels résolus par noms.\n", err)
+		return nil
+	}
+
+	// Sous Tests, "p [p.test]" remplace "p"; le paquet main généré "p.test" est écarté.
+	testVariants := make(map[string]bool)
+	for _, pkg := range loaded {
+		if strings.HasSuffix(pkg.ID, ".test]") && pkg.PkgPath+" ["+pkg.PkgPath+".test]" == pkg.ID {
+			testVariants[pkg.PkgPath] = true
+		}
+	}
+	var checked []*typeCheckPackage
+	errCount := 0
+	for _, pkg := range loaded {
+		if strings.HasSuffix(pkg.ID, ".test") || pkg.ID == pkg.PkgPath && testVariants[pkg.PkgPath] {
+			continue
+		}
+		errCount += len(pkg.Errors)
+		checked = append(checked, &typeCheckPackage{
+			importPath: pkg.PkgPath,
+			files:      pkg.Syntax,
+			pkg:        pkg.Types,
+			info:       pkg.TypesInfo,
+			errCount:   len(pkg.Errors),
+		})
+	}
+	if errCount > 0 {
+		logger.Printf("Avertissement: %d erreur(s) de chargement ou de types ignorées, résultats partiels.\n", errCount)
+	}
+	return checked
+}
+
+// fragmentObjects associe chaque objet déclaré par un fragment à l'ID de ce fragment.
+func fragmentObjects(packages []*typeCheckPackage, declIDs map[*ast.Ident]string) map[types.Object]string {
+	objIDs := make(map[types.Object]string)
+	for _, p := range packages {
+		if p.info == nil {
+			continue
+		}
+		for ident, obj := range p.info.Defs {
+			if id, ok := declIDs[ident]; ok && obj != nil {
+				objIDs[obj] = id
+			}
+		}
+	}
+	return objIDs
+}
+
+// markTestedFragments positionne HasTest sur les fragments appelés depuis un fichier _test.go,
+// quelle que soit la fonction du test (Test*, Benchmark*, helpers, closures de t.Run).
+// Les appels sont résolus comme pour DirectCallsInternal: un appel via une interface ne compte pas.
+func markTestedFragments(packages []*typeCheckPackage, files []parsedFile, declIDs map[*ast.Ident]string, fragments map[string]FragmentInfo) {
+	testFiles := make(map[*ast.File]bool)
+	for _, f := range files {
+		if f.isTest {
+			testFiles[f.node] = true
+		}
+	}
+	objIDs := fragmentObjects(packages, declIDs)
+	for _, p := range packages {
+		if p.info == nil {
+			continue
+		}
+		for _, file := range p.files {
+			if !testFiles[file] {
+				continue
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				if ident := calleeIdent(call.Fun); ident != nil {
+					if fn, ok := p.info.Uses[ident].(*types.Func); ok {
+						if id, ok := objIDs[fn.Origin()]; ok {
+							info := fragments[id]
+							info.HasTest = true
+							fragments[id] = info
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+}
+
+// isExportedFragment indique si un fragment fait partie de l'API exportée (-exported-only).
+// Une méthode exportée d'un type non exporté n'en fait partie qu'avec keepUnexportedReceivers;
+// un const_group en fait partie dès qu'une de ses constantes est exportée.
+func isExportedFragment(info FragmentInfo, keepUnexportedReceivers bool) bool {
+	if info.FragmentType == "const_group" {
+		for _, member := range info.Members {
+			if ast.IsExported(member.Name) {
+				return true
+			}
+		}
+		return false
+	}
+	if !ast.IsExported(info.Identifier) {
+		return false
+	}
+	return info.FragmentType != "method" || keepUnexportedReceivers || ast.IsExported(receiverBaseName(info.ReceiverType))
+}
+
+// isTestExportFile indique si relPath est un fichier export_test.go, ou une variante par
+// plateforme (export_linux_test.go): la convention qui expose des internes du paquet à ses
+// tests externes (paquet x_test).
+func isTestExportFile(relPath string) bool {
+	name := path.Base(relPath)
+	return name == "export_test.go" || strings.HasPrefix(name, "export_") && strings.HasSuffix(name, "_test.go")
+}
+
+// testFuncKind retourne le type de fonction de test reconnu par go test d'après le préfixe du
+// nom (test, benchmark, fuzz, example), ou "" pour un helper. Comme pour go test, le préfixe
+// doit être suivi de la fin du nom ou d'un caractère non minuscule: Testing n'est pas un test.
+func testFuncKind(name string) string {
+	for _, kind := range []struct{ prefix, kind string }{
+		{"Test", "test"},
+		{"Benchmark", "benchmark"},
+		{"Fuzz", "fuzz"},
+		{"Example", "example"},
+	} {
+		if !strings.HasPrefix(name, kind.prefix) {
+			continue
+		}
+		rest := name[len(kind.prefix):]
+		if rest == "" {
+			return kind.kind
+		}
+		if r, _ := utf8.DecodeRuneInString(rest); !unicode.IsLower(r) {
+			return kind.kind
+		}
+	}
+	return ""
+}
+
+// untestedExported retourne les IDs triés des fonctions et méthodes exportées sans HasTest.
+// Comme pour flagUndocumented, une méthode n'est exportée que si son receveur l'est aussi.
+// Heuristique structurelle: un appel depuis un test ne dit rien de la couverture réelle.
+func untestedExported(fragments map[string]FragmentInfo) []string {
+	var untested []string
+	for id, info := range fragments {
+		if info.FragmentType != "function" && info.FragmentType != "method" {
+			continue
+		}
+		if !ast.IsExported(info.Identifier) || info.HasTest || info.IsTest {
+			continue
+		}
+		if info.FragmentType == "method" && !ast.IsExported(receiverBaseName(info.ReceiverType)) {
+			continue
+		}
+		untested = append(untested, id)
+	}
+	sort.Strings(untested)
+	return untested
+}
+
+// callRef est un appel relevé syntaxiquement dans le corps d'une fonction: f() dans le paquet
+// (importPath vide) ou pkg.F() vers le chemin d'import de pkg.
+type callRef struct {
+	importPath string
+	name       string
+}
+
+// collectCallRefs relève les appels f(), f[T]() et pkg.F() d'un corps de fonction. Un
+// identifiant résolu par le parseur vers autre chose qu'une fonction du fichier (variable
+// locale, paramètre) est écarté; x.M() n'est retenu que si x est un import du fichier.
+func collectCallRefs(body *ast.BlockStmt, imports []ImportInfo) []callRef {
+	importsByName := make(map[string]string, len(imports))
+	for _, imp := range imports {
+		importsByName[importLocalName(imp)] = imp.Path
+	}
+	seen := make(map[callRef]bool)
+	var refs []callRef
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		fun := call.Fun
+		for {
+			switch e := fun.(type) {
+			case *ast.ParenExpr:
+				fun = e.X
+				continue
+			case *ast.IndexExpr:
+				fun = e.X
+				continue
+			case *ast.IndexListExpr:
+				fun = e.X
+				continue
+			}
+			break
+		}
+		var ref callRef
+		switch e := fun.(type) {
+		case *ast.Ident:
+			if e.Obj != nil && e.Obj.Kind != ast.Fun {
+				return true
+			}
+			ref = callRef{name: e.Name}
+		case *ast.SelectorExpr:
+			x, ok := e.X.(*ast.Ident)
+			if !ok || x.Obj != nil || importsByName[x.Name] == "" {
+				return true
+			}
+			ref = callRef{importPath: importsByName[x.Name], name: e.Sel.Name}
+		default:
+			return true
+		}
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+		return true
+	})
+	return refs
+}
+
+// isTypeParam indique si obj, de genre ast.Typ, est un paramètre de type: le parseur le déclare
+// par un champ de la liste TypeParams (func Map[T, U any], type G[T any]), là où un type du
+// paquet est déclaré par un *ast.TypeSpec.
+func isTypeParam(obj *ast.Object) bool {
+	_, ok := obj.Decl.(*ast.Field)
+	return ok
+}
+
+// typeRefsIn retourne les identifiants non qualifiés cités en position de type dans node:
+// types des paramètres, résultats, receveur et champs, littéraux composites, assertions et
+// switchs de type, déclarations var, conversions T(x) et types composés ([]T, map[K]V, chan T).
+// Les noms de champs et de paramètres, les sélecteurs pkg.T et les identifiants résolus par
+// le parseur vers autre chose qu'un type sont écartés, de même que les paramètres de type
+// (déclarés par TypeParams ou par le receveur); le filtrage final se fait contre les fragments
+// type du paquet (cf. resolveTypesUsed), ce qui exclut aussi int, string, etc.
+func typeRefsIn(node ast.Node) []string {
+	seen := make(map[string]bool)
+	// Les paramètres de type du receveur (func (g G[T]) M()) ne sont pas résolus par le
+	// parseur: leurs identifiants restent sans Obj et passeraient pour des types du paquet.
+	recvParams := make(map[string]bool)
+	if fn, ok := node.(*ast.FuncDecl); ok && fn.Recv != nil && len(fn.Recv.List) > 0 {
+		for _, param := range receiverTypeParams(fn.Recv.List[0].Type) {
+			recvParams[param.Name] = true
+		}
+	}
+	var refs []string
+	var collect func(expr ast.Node)
+	collect = func(expr ast.Node) {
+		if expr == nil {
+			return
+		}
+		ast.Inspect(expr, func(n ast.Node) bool {
+			switch e := n.(type) {
+			case *ast.Field:
+				collect(e.Type)
+				return false
+			case *ast.SelectorExpr:
+				return false
+			case *ast.Ident:
+				if (e.Obj == nil && !recvParams[e.Name] || e.Obj != nil && e.Obj.Kind == ast.Typ && !isTypeParam(e.Obj)) && !seen[e.Name] {
+					seen[e.Name] = true
+					refs = append(refs, e.Name)
+				}
+			}
+			return true
+		})
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.Field:
+			collect(e.Type)
+			return false
+		case *ast.TypeSpec:
+			if e.TypeParams != nil {
+				collect(e.TypeParams)
+			}
+			collect(e.Type)
+			return false
+		case *ast.CompositeLit:
+			collect(e.Type)
+		case *ast.TypeAssertExpr:
+			collect(e.Type)
+		case *ast.ValueSpec:
+			collect(e.Type)
+		case *ast.ArrayType, *ast.MapType, *ast.ChanType:
+			collect(e)
+			return false
+		case *ast.TypeSwitchStmt:
+			for _, stmt := range e.Body.List {
+				if clause, ok := stmt.(*ast.CaseClause); ok {
+					for _, expr := range clause.List {
+						collect(expr)
+					}
+				}
+			}
+		case *ast.CallExpr:
+			fun := e.Fun
+			for {
+				paren, ok := fun.(*ast.ParenExpr)
+				if !ok {
+					break
+				}
+				fun = paren.X
+			}
+			switch fun.(type) {
+			case *ast.Ident, *ast.StarExpr:
+				collect(fun) // Conversion T(x) ou (*T)(x); un appel de fonction est écarté au filtrage
+			}
+		}
+		return true
+	})
+	return refs
+}
+
+// indexByName associe key à id dans index. Un même nom peut être déclaré par plusieurs fichiers
+// sous contraintes de build exclusives (http2_type_T et omithttp2_type_T): le plus petit ID
+// est retenu pour que la résolution ne dépende pas de l'ordre de parcours de la map.
+func indexByName(index map[string]string, key, id string) {
+	if prev, ok := index[key]; !ok || id < prev {
+		index[key] = id
+	}
+}
+
+// resolveTypesUsed remplit TypesUsedInternal avec les IDs des fragments type du même paquet
+// dont le nom figure dans typeRefs. Un type ne se liste pas lui-même (type Node struct{ next *Node }).
+func resolveTypesUsed(fragments map[string]FragmentInfo) {
+	index := newNameIndex()
+	for id, info := range fragments {
+		index.add(id, info)
+	}
+	for id, info := range fragments {
+		if len(info.typeRefs) == 0 {
+			continue
+		}
+		info.TypesUsedInternal = index.typesUsed(id, info)
+		fragments[id] = info
+	}
+}
+
+// resolveCallsByName remplit DirectCallsInternal des fonctions et méthodes à partir de leurs
+// callRefs: f() est résolu parmi les fonctions du même paquet, pkg.F() parmi celles du paquet
+// du projet ayant ce chemin d'import. Les appels de méthodes, de fonctions hors projet et
+// les conversions sont ignorés. -type-check remplace ce résultat pour les paquets vérifiés
+// sans erreur, et le complète pour les paquets en erreur de types (resolveCallsWithTypes).
+func resolveCallsByName(fragments map[string]FragmentInfo) {
+	index := newNameIndex()
+	for id, info := range fragments {
+		index.add(id, info)
+	}
+	for id, info := range fragments {
+		if len(info.callRefs) == 0 {
+			continue
+		}
+		info.DirectCallsInternal = index.calls(info)
+		fragments[id] = info
+	}
+}
+
+// nameIndex indexe les fonctions et les types par nom pour résoudre callRefs et typeRefs.
+// Il ne retient que des IDs: -spill-dir le remplit en relisant les lots.
+type nameIndex struct {
+	types     map[string]string // packageKey + "." + nom -> ID
+	functions map[string]string // packageKey + "." + nom -> ID
+	imported  map[string]string // chemin d'import + "." + nom -> ID
+}
+
+func newNameIndex() *nameIndex {
+	return &nameIndex{types: make(map[string]string), functions: make(map[string]string), imported: make(map[string]string)}
+}
+
+// add indexe le fragment id s'il s'agit d'un type ou d'une fonction.
+func (x *nameIndex) add(id string, info FragmentInfo) {
+	switch info.FragmentType {
+	case "type":
+		indexByName(x.types, packageKey(info)+"."+info.Identifier, id)
+	case "function":
+		indexByName(x.functions, packageKey(info)+"."+info.Identifier, id)
+		if info.importPath != "" {
+			indexByName(x.imported, info.importPath+"."+info.Identifier, id)
+		}
+	}
+}
+
+// typesUsed retourne les IDs triés des types du paquet de info nommés dans typeRefs, sauf id.
+func (x *nameIndex) typesUsed(id string, info FragmentInfo) []string {
+	used := make(map[string]bool)
+	for _, name := range info.typeRefs {
+		if typeID, ok := x.types[packageKey(info)+"."+name]; ok && typeID != id {
+			used[typeID] = true
+		}
+	}
+	return sortedKeys(used)
+}
+
+// calls retourne les IDs triés des fonctions du projet appelées d'après callRefs.
+func (x *nameIndex) calls(info FragmentInfo) []string {
+	calls := make(map[string]bool)
+	for _, ref := range info.callRefs {
+		var callee string
+		if ref.importPath == "" {
+			callee = x.functions[packageKey(info)+"."+ref.name]
+		} else {
+			callee = x.imported[ref.importPath+"."+ref.name]
+		}
+		if callee != "" {
+			calls[callee] = true
+		}
+	}
+	return sortedKeys(calls)
+}
+
+// resolveCallsWithTypes remplit DirectCallsInternal des fonctions et méthodes avec les IDs
+// des fragments appelés, résolus exactement via go/types (identifiants masqués, sélecteurs
+// homonymes et appels de méthodes inclus). Les appels vers des fonctions hors projet,
+// les appels dynamiques (valeurs de fonction, méthodes d'interface) et les conversions sont ignorés.
+// Un paquet non vérifié (info absente) garde les appels résolus par resolveCallsByName. Un
+// paquet en erreur de types les garde aussi, complétés des appels que go/types a pu résoudre
+// (appels de méthodes compris): ses informations partielles omettent des appels.
+func resolveCallsWithTypes(packages []*typeCheckPackage, declIDs map[*ast.Ident]string, fragments map[string]FragmentInfo) {
+	objIDs := fragmentObjects(packages, declIDs)
+
+	for _, p := range packages {
+		if p.info == nil {
+			continue
+		}
+		for _, file := range p.files {
+			for _, decl := range file.Decls {
+				fd, ok := decl.(*ast.FuncDecl)
+				if !ok || fd.Body == nil {
+					continue
+				}
+				callerID, ok := declIDs[fd.Name]
+				if !ok {
+					continue
+				}
+				calls := make(map[string]bool)
+				if p.errCount > 0 {
+					for _, id := range fragments[callerID].DirectCallsInternal {
+						calls[id] = true
+					}
+				}
+				ast.Inspect(fd.Body, func(n ast.Node) bool {
+					call, ok := n.(*ast.CallExpr)
+					if !ok {
+						return true
+					}
+					if ident := calleeIdent(call.Fun); ident != nil {
+						if fn, ok := p.info.Uses[ident].(*types.Func); ok {
+							if id, ok := objIDs[fn.Origin()]; ok {
+								calls[id] = true
+							}
+						}
+					}
+					return true
+				})
+				info := fragments[callerID]
+				info.DirectCallsInternal = sortedKeys(calls)
+				fragments[callerID] = info
+			}
+		}
+	}
+}
+
+// resolveConstValues renseigne ResolvedValue des constantes et des membres de const_group avec
+// la valeur calculée par go/types: exacte pour les entiers, chaînes et booléens (une chaîne est
+// entre guillemets), décimale arrondie pour les flottants et complexes. Une constante dont la
+// valeur n'a pas pu être calculée (erreur de types, import hors projet introuvable) reste sans valeur.
+func resolveConstValues(packages []*typeCheckPackage, declIDs map[*ast.Ident]string, fragments map[string]FragmentInfo) {
+	for _, p := range packages {
+		if p.info == nil {
+			continue
+		}
+		for ident, obj := range p.info.Defs {
+			c, ok := obj.(*types.Const)
+			if !ok || c.Val().Kind() == constant.Unknown {
+				continue
+			}
+			id, ok := declIDs[ident]
+			if !ok {
+				continue
+			}
+			value := c.Val().ExactString()
+			if kind := c.Val().Kind(); kind == constant.Float || kind == constant.Complex {
+				value = c.Val().String()
+			}
+			info := fragments[id]
+			switch info.FragmentType {
+			case "constant":
+				info.ResolvedValue = value
+			case "const_group":
+				for i := range info.Members {
+					if info.Members[i].Name == ident.Name {
+						info.Members[i].ResolvedValue = value
+					}
+				}
+			}
+			fragments[id] = info
+		}
+	}
+}
+
+// checkStructAlignment renseigne StructSize et FieldAlignmentSavings des structs du projet.
+// Les tailles sont celles du compilateur gc sur amd64 (mots de 64 bits): sur une
+// architecture 32 bits, le padding réel peut différer. L'ordre optimal de référence place
+// les champs de taille nulle en tête puis trie par alignement puis taille décroissants,
+// ce qui minimise le padding. Les types génériques et les alias sont ignorés, de même que
+// les structs dont un champ n'a pas pu être typé.
+func checkStructAlignment(packages []*typeCheckPackage, declIDs map[*ast.Ident]string, fragments map[string]FragmentInfo) {
+	sizes := types.SizesFor("gc", "amd64")
+	for _, p := range packages {
+		if p.info == nil {
+			continue
+		}
+		for ident, obj := range p.info.Defs {
+			id, ok := declIDs[ident]
+			if !ok {
+				continue
+			}
+			typeName, ok := obj.(*types.TypeName)
+			if !ok || typeName.IsAlias() {
+				continue
+			}
+			if named, ok := typeName.Type().(*types.Named); ok && named.TypeParams().Len() > 0 {
+				continue
+			}
+			st, ok := typeName.Type().Underlying().(*types.Struct)
+			if !ok || st.NumFields() == 0 {
+				continue
+			}
+			fields := make([]*types.Var, st.NumFields())
+			valid := true
+			for i := range fields {
+				fields[i] = st.Field(i)
+				if basic, ok := fields[i].Type().(*types.Basic); ok && basic.Kind() == types.Invalid {
+					valid = false
+				}
+			}
+			if !valid {
+				continue
+			}
+			sort.SliceStable(fields, func(i, j int) bool {
+				zi, zj := sizes.Sizeof(fields[i].Type()) == 0, sizes.Sizeof(fields[j].Type()) == 0
+				if zi != zj {
+					return zi
+				}
+				ai, aj := sizes.Alignof(fields[i].Type()), sizes.Alignof(fields[j].Type())
+				if ai != aj {
+					return ai > aj
+				}
+				return sizes.Sizeof(fields[i].Type()) > sizes.Sizeof(fields[j].Type())
+			})
+			current := sizes.Sizeof(st)
+			optimal := sizes.Sizeof(types.NewStruct(fields, nil))
+
+			info := fragments[id]
+			info.StructSize = int(current)
+			if optimal < current {
+				info.FieldAlignmentSavings = int(current - optimal)
+			}
+			fragments[id] = info
+		}
+	}
+}
+
+// splitCallEdges répartit DirectCallsInternal de chaque fragment entre appels vers le même
+// paquet (même packageKey) et vers d'autres paquets du projet, dans l'ordre d'origine.
+// DirectCallsInternal reste renseigné: c'est l'union des deux listes.
+func splitCallEdges(fragments map[string]FragmentInfo) {
+	for id, info := range fragments {
+		if len(info.DirectCallsInternal) == 0 {
+			continue
+		}
+		info.DirectCallsSamePackage, info.DirectCallsCrossPackage = nil, nil
+		for _, callee := range info.DirectCallsInternal {
+			if packageKey(fragments[callee]) == packageKey(info) {
+				info.DirectCallsSamePackage = append(info.DirectCallsSamePackage, callee)
+			} else {
+				info.DirectCallsCrossPackage = append(info.DirectCallsCrossPackage, callee)
+			}
+		}
+		fragments[id] = info
+	}
+}
+
+// calleeIdent retourne l'identifiant désignant la cible d'un appel: f(), pkg.F(), x.M(), F[T]().
+func calleeIdent(fun ast.Expr) *ast.Ident {
+	switch e := fun.(type) {
+	case *ast.ParenExpr:
+		return calleeIdent(e.X)
+	case *ast.Ident:
+		return e
+	case *ast.SelectorExpr:
+		return e.Sel
+	case *ast.IndexExpr:
+		return calleeIdent(e.X)
+	case *ast.IndexListExpr:
+		return calleeIdent(e.X)
+	}
+	return nil
+}
+
+// readModulePath retourne le chemin de module déclaré dans le go.mod de la racine, ou "" si absent.
+func readModulePath(src sourceFS, projectRootDirAbs string) string {
+	content, err := src.readFile(filepath.Join(projectRootDirAbs, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "module") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module")), `"`)
+		}
+	}
+	return ""
+}
+
+// gitDirtyGoFiles retourne les chemins absolus des fichiers .go modifiés, ajoutés, renommés
+// ou non suivis du dépôt git contenant dir, que les changements soient indexés ou non
+// (git status --porcelain). Les fichiers supprimés sont ignorés. Les chemins rapportés par
+// git sont relatifs à la racine du dépôt, qui peut être un parent de dir.
+func gitDirtyGoFiles(dir string) (map[string]bool, error) {
+	topLevel, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, fmt.Errorf("recherche de la racine du dépôt git: %v", err)
+	}
+	repoRoot := strings.TrimSpace(string(topLevel))
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	out, err := exec.Command("git", "-C", repoRoot, "status", "--porcelain", "-z", "--untracked-files=all").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status: %v", err)
+	}
+	files := make(map[string]bool)
+	entries := strings.Split(string(out), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		// "XY chemin": X = index (indexé), Y = arbre de travail (non indexé).
+		status, relPath := entry[:2], entry[3:]
+		if status[0] == 'R' || status[0] == 'C' {
+			i++ // Le chemin d'origine d'un renommage/copie suit dans l'entrée suivante.
+		}
+		if status[0] == 'D' || status[1] == 'D' || !strings.HasSuffix(strings.ToLower(relPath), ".go") {
+			continue
+		}
+		// git donne la racine sans lien symbolique: ramener le chemin sous dir tel que parcouru.
+		rel, err := filepath.Rel(resolvedDir, filepath.Join(repoRoot, filepath.FromSlash(relPath)))
+		if err != nil {
+			continue
+		}
+		files[filepath.Join(dir, rel)] = true
+	}
+	return files, nil
+}
+
+// readGoVersion retourne la version de la directive go du go.mod de dir (ex: "1.21.3"),
+// ou "" si absente.
+func readGoVersion(src sourceFS, dir string) string {
+	content, err := src.readFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "go" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// goVersionAtLeast indique si la version Go "1.N[.P]" est au moins major.minor.
+// Une version vide ou illisible est considérée antérieure.
+func goVersionAtLeast(version string, major, minor int) bool {
+	var vMajor, vMinor int
+	if _, err := fmt.Sscanf(version, "%d.%d", &vMajor, &vMinor); err != nil {
+		return false
+	}
+	return vMajor > major || (vMajor == major && vMinor >= minor)
+}
+
+// readLocalReplaces retourne les directives replace du go.mod racine dont la cible est un
+// répertoire local (chemin commençant par ./, ../ ou absolu), résolu en chemin absolu.
+// Les remplacements par une version d'un autre module sont signalés puis ignorés.
+func readLocalReplaces(src sourceFS, projectRootDirAbs string, logger Logger) []localReplace {
+	content, err := src.readFile(filepath.Join(projectRootDirAbs, "go.mod"))
+	if err != nil {
+		logger.Printf("Avertissement: -follow-replaces sans go.mod lisible: %v\n", err)
+		return nil
+	}
+	var replaces []localReplace
+	inBlock := false
+	for _, line := range strings.Split(string(content), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case inBlock && line == ")":
+			inBlock = false
+			continue
+		case strings.HasPrefix(line, "replace") && strings.TrimSpace(strings.TrimPrefix(line, "replace")) == "(":
+			inBlock = true
+			continue
+		case strings.HasPrefix(line, "replace "), strings.HasPrefix(line, "replace\t"):
+			line = strings.TrimSpace(strings.TrimPrefix(line, "replace"))
+		case !inBlock:
+			continue
+		}
+		parts := strings.SplitN(line, "=>", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		oldFields, newFields := strings.Fields(parts[0]), strings.Fields(parts[1])
+		if len(oldFields) == 0 || len(newFields) == 0 {
+			continue
+		}
+		modulePath := strings.Trim(oldFields[0], `"`)
+		target := strings.Trim(newFields[0], `"`)
+		if len(newFields) > 1 || !(strings.HasPrefix(target, "./") || strings.HasPrefix(target, "../") || filepath.IsAbs(target)) {
+			logger.Printf("replace non local ignoré: %s => %s\n", modulePath, strings.Join(newFields, " "))
+			continue
+		}
+		dirAbs := target
+		if !filepath.IsAbs(dirAbs) {
+			dirAbs = filepath.Join(projectRootDirAbs, filepath.FromSlash(target))
+		}
+		if fi, err := src.stat(dirAbs); err != nil || !fi.IsDir() {
+			logger.Printf("Avertissement: cible replace introuvable pour %s: %s\n", modulePath, dirAbs)
+			continue
+		}
+		replaces = append(replaces, localReplace{modulePath: modulePath, dirAbs: dirAbs})
+	}
+	return replaces
+}
+
+// importPathForDir retourne le chemin d'import d'un répertoire relatif à la racine du module.
+// Sans chemin de module, le répertoire relatif lui-même sert d'identifiant de paquet.
+func importPathForDir(modulePath, relDir string) string {
+	switch {
+	case modulePath == "":
+		return relDir
+	case relDir == ".":
+		return modulePath
+	}
+	return modulePath + "/" + relDir
+}
+
+// sortedKeys retourne les clés d'un ensemble, triées.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// --- Fonctions Helper (getDocstring, extractImports, buildSignatureString, typeToString, formatNode, sanitizeIdentifier) ---
+// Ces fonctions restent globalement les mêmes que dans les versions précédentes.
+// sanitizeIdentifier n'a plus besoin de base64.
+
+// requiresAnyBuildTag indique si la contrainte de build du fichier (//go:build ou // +build,
+// avant la clause package) exige une des tags: la tag doit y apparaître sans négation,
+// ex: "legacy" ou "legacy && linux", mais pas "!legacy".
+func requiresAnyBuildTag(file *ast.File, tags map[string]bool) bool {
+	for _, cg := range file.Comments {
+		if cg.Pos() >= file.Package {
+			break
+		}
+		for _, c := range cg.List {
+			if !constraint.IsGoBuild(c.Text) && !constraint.IsPlusBuild(c.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(c.Text)
+			if err == nil && exprRequiresTag(expr, tags, false) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exprRequiresTag indique si expr contient une des tags hors négation.
+func exprRequiresTag(expr constraint.Expr, tags map[string]bool, negated bool) bool {
+	switch e := expr.(type) {
+	case *constraint.TagExpr:
+		return !negated && tags[e.Tag]
+	case *constraint.NotExpr:
+		return exprRequiresTag(e.X, tags, !negated)
+	case *constraint.AndExpr:
+		return exprRequiresTag(e.X, tags, negated) || exprRequiresTag(e.Y, tags, negated)
+	case *constraint.OrExpr:
+		return exprRequiresTag(e.X, tags, negated) || exprRequiresTag(e.Y, tags, negated)
+	}
+	return false
+}
+
+// digestAlgorithms associe les valeurs de -digest à leur fonction de hachage. blake2b est
+// BLAKE2b-256 (32 octets, comme sha256). Les IDs de fragments restent dérivés de SHA-1.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"blake2b": func() hash.Hash {
+		h, _ := blake2b.New256(nil) // Erreur seulement pour une clé de plus de 64 octets
+		return h
+	},
+}
+
+// contentDigest retourne le digest hexadécimal de data selon Options.Digest: CodeDigest,
+// digests de fichiers, de paquets et de blocs.
+func (o *Options) contentDigest(data []byte) string {
+	h := digestAlgorithms[o.Digest]()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fileDigest calcule les digests brut et normalisé (format.Source, comme gofmt) d'un
+// fichier. FormatDigest est vide si le contenu ne peut pas être formaté.
+func (o *Options) fileDigest(content []byte) FileDigest {
+	digest := FileDigest{Digest: o.contentDigest(content)}
+	if formatted, err := format.Source(content); err == nil {
+		digest.FormatDigest = o.contentDigest(formatted)
+	}
+	return digest
+}
+
+// embedPatterns retourne les motifs des directives //go:embed de doc, dans l'ordre: plusieurs
+// par directive, séparés par des espaces, éventuellement entre guillemets ou backquotes
+// ("mon fichier.txt"). Un motif entre guillemets illisible est repris tel qu'écrit.
+func embedPatterns(doc *ast.CommentGroup) []string {
+	if doc == nil {
+		return nil
+	}
+	var patterns []string
+	for _, c := range doc.List {
+		args, ok := strings.CutPrefix(c.Text, "//go:embed")
+		if !ok || args != "" && args[0] != ' ' && args[0] != '\t' {
+			continue
+		}
+		for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+			end := strings.IndexAny(args, " \t")
+			if args[0] == '"' || args[0] == '`' {
+				if prefix, err := strconv.QuotedPrefix(args); err == nil {
+					pattern, _ := strconv.Unquote(prefix)
+					patterns = append(patterns, pattern)
+					args = args[len(prefix):]
+					continue
+				}
+			}
+			if end < 0 {
+				end = len(args)
+			}
+			patterns = append(patterns, args[:end])
+			args = args[end:]
+		}
+	}
+	return patterns
+}
+
+// goGenerateDirectives retourne les directives //go:generate d'un fichier parsé.
+func goGenerateDirectives(fset *token.FileSet, file *ast.File, originalPath string) []goGenerateDirective {
+	var directives []goGenerateDirective
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			if strings.HasPrefix(c.Text, "//go:generate ") {
+				directives = append(directives, goGenerateDirective{
+					file:    originalPath,
+					line:    fset.PositionFor(c.Pos(), false).Line,
+					command: strings.TrimSpace(strings.TrimPrefix(c.Text, "//go:generate ")),
+				})
+			}
+		}
+	}
+	return directives
+}
+
+// generatorFor retourne la directive //go:generate qui a probablement produit generatedFile
+// parmi celles de son dossier, ou false. Heuristique, par ordre de priorité:
+//  1. la commande cite le nom du fichier généré (ex: -output foo_string.go, -o api.pb.go);
+//  2. convention de stringer: -type=Foo produit foo_string.go;
+//  3. le dossier ne contient qu'une directive.
+//
+// Limites: une directive écrivant dans un autre dossier, un nom de sortie calculé par le
+// générateur (protoc, mockgen sans -destination) ou plusieurs directives ambiguës dans le même
+// dossier ne sont pas reliés; un nom cité par hasard peut produire un faux lien.
+func generatorFor(generatedFile string, directives []goGenerateDirective) (goGenerateDirective, bool) {
+	base := path.Base(generatedFile)
+	for _, d := range directives {
+		for _, arg := range strings.Fields(d.command) {
+			if i := strings.IndexByte(arg, '='); i >= 0 {
+				arg = arg[i+1:]
+			}
+			if path.Base(strings.Trim(arg, `"'`)) == base {
+				return d, true
+			}
+		}
+	}
+	for _, d := range directives {
+		fields := strings.Fields(d.command)
+		if len(fields) == 0 || path.Base(fields[0]) != "stringer" {
+			continue
+		}
+		for i, arg := range fields {
+			var types string
+			switch {
+			case strings.HasPrefix(arg, "-type="):
+				types = strings.TrimPrefix(arg, "-type=")
+			case arg == "-type" && i+1 < len(fields):
+				types = fields[i+1]
+			}
+			if first := strings.Split(types, ",")[0]; first != "" && strings.ToLower(first)+"_string.go" == base {
+				return d, true
+			}
+		}
+	}
+	if len(directives) == 1 {
+		return directives[0], true
+	}
+	return goGenerateDirective{}, false
+}
+
+// linkGeneratedFragments renseigne GeneratedBy des fragments des fichiers générés avec la
+// directive //go:generate probable de leur dossier (cf. generatorFor).
+func linkGeneratedFragments(fragments map[string]FragmentInfo, generatedFiles map[string]bool, directives map[string][]goGenerateDirective) {
+	links := make(map[string]string)
+	for file := range generatedFiles {
+		if d, ok := generatorFor(file, directives[path.Dir(file)]); ok {
+			links[file] = fmt.Sprintf("%s:%d: %s", d.file, d.line, d.command)
+		}
+	}
+	for id, info := range fragments {
+		if by, ok := links[info.OriginalPath]; ok {
+			info.GeneratedBy = by
+			fragments[id] = info
+		}
+	}
+}
+
+// fileHeaderComment retourne le texte du premier groupe de commentaires précédant la clause
+// package (typiquement l'en-tête de licence/SPDX), ou "" s'il n'y en a pas.
+// Le commentaire de documentation du paquet (groupe attaché à la clause package) n'est pas
+// un en-tête, et les groupes ne contenant que des directives (//go:build, // +build) sont ignorés.
+func fileHeaderComment(file *ast.File) string {
+	for _, cg := range file.Comments {
+		if cg.Pos() >= file.Package || cg == file.Doc {
+			break
+		}
+		if text := strings.TrimSpace(headerCommentText(cg)); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// headerCommentText retourne le texte d'un groupe de commentaires sans les lignes de
+// contrainte de build, que CommentGroup.Text ne retire pas toutes (// +build).
+func headerCommentText(cg *ast.CommentGroup) string {
+	var kept []*ast.Comment
+	for _, c := range cg.List {
+		if strings.HasPrefix(c.Text, "//go:build") || strings.HasPrefix(c.Text, "// +build") {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return (&ast.CommentGroup{List: kept}).Text()
+}
+
+func getDocstring(doc *ast.CommentGroup) string {
+	if doc != nil {
+		return strings.TrimSpace(doc.Text())
+	}
+	return ""
+}
+
+// generatedHeaderRe est la ligne d'en-tête conventionnelle des fichiers générés (cf. go help generate).
+var generatedHeaderRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGeneratedSource indique si le contenu porte l'en-tête de code généré avant le premier
+// texte qui n'est ni un commentaire ni une ligne vide, sans parser le fichier.
+func isGeneratedSource(content []byte) bool {
+	inBlockComment := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(content)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case inBlockComment:
+			if strings.Contains(trimmed, "*/") {
+				inBlockComment = false
+			}
+		case generatedHeaderRe.MatchString(line):
+			return true
+		case trimmed == "" || strings.HasPrefix(trimmed, "//"):
+		case strings.HasPrefix(trimmed, "/*"):
+			inBlockComment = !strings.Contains(trimmed[2:], "*/")
+		default:
+			return false // Premier texte hors commentaire: l'en-tête ne peut plus apparaître
+		}
+	}
+	return false
+}
+
+// commentLines retourne l'ensemble des lignes physiques du fichier couvertes par un commentaire,
+// commentaires de ligne (//) comme de bloc (/* */, chaque ligne couverte comptant une fois).
+func commentLines(fset *token.FileSet, node *ast.File) map[int]bool {
+	lines := make(map[int]bool)
+	for _, group := range node.Comments {
+		for _, c := range group.List {
+			start := fset.PositionFor(c.Pos(), false).Line
+			end := fset.PositionFor(c.End(), false).Line
+			for line := start; line <= end; line++ {
+				lines[line] = true
+			}
+		}
+	}
+	return lines
+}
+
+// possibleLoopVarCapture indique si body contient, dans une boucle for déclarant ses
+// variables (for i := ...; for k, v := range ...), une instruction go func(){...}() dont le
+// corps référence une de ces variables sans la recevoir en paramètre. Avant go1.22, toutes
+// les itérations partagent la variable et la goroutine risque d'en lire une valeur ultérieure.
+// Heuristique syntaxique: les références sont comparées par nom, sans tenir compte d'une
+// redéclaration dans la closure ou d'une copie (v := v) faite dans la boucle avant le go,
+// et seuls les littéraux de fonction lancés directement par go sont examinés.
+func possibleLoopVarCapture(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		var loopVars []ast.Expr
+		var loopBody *ast.BlockStmt
+		switch loop := n.(type) {
+		case *ast.RangeStmt:
+			if loop.Tok == token.DEFINE {
+				loopVars = []ast.Expr{loop.Key, loop.Value}
+			}
+			loopBody = loop.Body
+		case *ast.ForStmt:
+			if init, ok := loop.Init.(*ast.AssignStmt); ok && init.Tok == token.DEFINE {
+				loopVars = init.Lhs
+			}
+			loopBody = loop.Body
+		default:
+			return true
+		}
+		names := make(map[string]bool)
+		for _, expr := range loopVars {
+			if id, ok := expr.(*ast.Ident); ok && id.Name != "_" {
+				names[id.Name] = true
+			}
+		}
+		if len(names) == 0 || loopBody == nil {
+			return true
+		}
+		ast.Inspect(loopBody, func(n ast.Node) bool {
+			goStmt, ok := n.(*ast.GoStmt)
+			if !ok || found {
+				return !found
+			}
+			lit, ok := goStmt.Call.Fun.(*ast.FuncLit)
+			if !ok {
+				return true
+			}
+			captured := make(map[string]bool, len(names))
+			for name := range names {
+				captured[name] = true
+			}
+			for _, field := range lit.Type.Params.List {
+				for _, param := range field.Names {
+					delete(captured, param.Name)
+				}
+			}
+			ast.Inspect(lit.Body, func(n ast.Node) bool {
+				switch x := n.(type) {
+				case *ast.SelectorExpr:
+					ast.Inspect(x.X, func(n ast.Node) bool {
+						if id, ok := n.(*ast.Ident); ok && captured[id.Name] {
+							found = true
+						}
+						return !found
+					})
+					return false
+				case *ast.Ident:
+					if captured[x.Name] {
+						found = true
+					}
+				}
+				return !found
+			})
+			return !found
+		})
+		return !found
+	})
+	return found
+}
+
+// lockReleases associe chaque méthode de verrouillage à la méthode qui la libère.
+var lockReleases = map[string]string{"Lock": "Unlock", "RLock": "RUnlock"}
+
+// possibleLockLeak indique si body appelle x.Lock() (ou x.RLock()) sans aucun appel
+// x.Unlock() (ou x.RUnlock()) sur la même expression x, différé ou non, y compris dans
+// une fonction différée (defer func() { x.Unlock() }()).
+// Heuristique purement syntaxique: les verrous sont comparés par le texte de leur
+// expression (s.mu, mu), sans suivi du flot de contrôle ni des alias. Elle ne détecte
+// donc pas un Unlock manquant sur un seul chemin (retour anticipé), et signale à tort
+// les fonctions qui rendent la main verrou pris (libéré par l'appelant).
+func possibleLockLeak(fset *token.FileSet, body *ast.BlockStmt) bool {
+	locked := make(map[string]bool)   // "<expr>.Unlock" attendus
+	released := make(map[string]bool) // "<expr>.Unlock" rencontrés
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		receiver := formatNode(fset, sel.X)
+		if release, ok := lockReleases[sel.Sel.Name]; ok {
+			locked[receiver+"."+release] = true
+		} else if sel.Sel.Name == "Unlock" || sel.Sel.Name == "RUnlock" {
+			released[receiver+"."+sel.Sel.Name] = true
+		}
+		return true
+	})
+	for key := range locked {
+		if !released[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// importsUsedBy retourne les chemins des imports référencés par node via un sélecteur pkg.Nom,
+// dans l'ordre des imports du fichier. Un identifiant lié localement (variable masquant un import)
+// n'est pas compté. Les imports "_" et "." ne peuvent pas être détectés ainsi et sont ignorés.
+func importsUsedBy(node ast.Node, imports []ImportInfo) []string {
+	used := make(map[string]bool)
+	ast.Inspect(node, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); ok && ident.Obj == nil {
+			used[ident.Name] = true
+		}
+		return true
+	})
+	var paths []string
+	for _, imp := range imports {
+		if used[importLocalName(imp)] {
+			paths = append(paths, imp.Path)
+		}
+	}
+	return paths
+}
+
+// importLocalName retourne le nom sous lequel un import est référencé dans le fichier:
+// l'alias s'il existe, sinon le dernier élément du chemin (en ignorant un suffixe de version majeure /vN).
+// Le nom réel du paquet peut différer de son chemin; ce cas n'est pas résolu sans vérification de types.
+func importLocalName(imp ImportInfo) string {
+	if imp.Name != "" {
+		return imp.Name
+	}
+	elems := strings.Split(imp.Path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && majorVersionRe.MatchString(name) {
+		name = elems[len(elems)-2]
+	}
+	return name
+}
+
+// majorVersionRe reconnaît un suffixe de version majeure de module (v2, v3...).
+var majorVersionRe = regexp.MustCompile(`^v[0-9]+$`)
+
+// extractImports retourne les imports du fichier dans leur ordre de déclaration dans le source
+// (node.Imports suit l'ordre syntaxique, y compris à travers plusieurs blocs import), dont
+// dépendent les outils de réécriture d'imports. Cet ordre ne dépend que du fichier: la sortie
+// reste déterministe quel que soit l'ordre de traitement des fichiers par les workers (-j).
+func extractImports(node *ast.File) []ImportInfo {
+	imports := []ImportInfo{}
+	if node == nil {
+		return imports
+	}
+	for _, imp := range node.Imports {
+		var importPath, alias string
+		if imp != nil && imp.Path != nil {
+			importPath = strings.Trim(imp.Path.Value, `"`)
+		}
+		if imp != nil && imp.Name != nil {
+			alias = imp.Name.Name
+		}
+		if importPath != "" {
+			imports = append(imports, ImportInfo{Name: alias, Path: importPath})
+		}
+	}
+	return imports
+}
+
+// markInternalImports marque IsInternalToModule les imports égaux au module ou situés sous lui.
+// Un module vide (pas de go.mod) ne marque rien.
+func markInternalImports(imports []ImportInfo, modulePath string) {
+	if modulePath == "" {
+		return
+	}
+	for i, imp := range imports {
+		imports[i].IsInternalToModule = imp.Path == modulePath || strings.HasPrefix(imp.Path, modulePath+"/")
+	}
+}
+
+// buildSignatureString formate la signature d'une fonction ou méthode sur une ligne, sans
+// le corps. Les noms de paramètres, de résultats et de receveur sont reproduits tels
+// qu'écrits: un identifiant blanc reste "_" (func (_ Foo) M(_ int)) et un nom absent reste
+// absent (func (*Foo) N(int)). ReceiverType, calculé à partir du seul type, n'en dépend pas.
+func buildSignatureString(fset *token.FileSet, f *ast.FuncDecl, logger Logger) string {
+	if f == nil {
+		return "<!nil FuncDecl!>"
+	}
+	signatureOnlyDecl := &ast.FuncDecl{Recv: f.Recv, Name: f.Name, Type: f.Type, Body: nil}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, signatureOnlyDecl); err != nil {
+		logger.Printf("Avertissement: format.Node échec signature %s: %v\n", f.Name.Name, err)
+		// Fallback très simple
+		fbSig := "func "
+		if f.Recv != nil && len(f.Recv.List) > 0 {
+			fbSig += "(" + typeToString(fset, f.Recv.List[0].Type) + ") "
+		}
+		if f.Name != nil {
+			fbSig += f.Name.Name
+		} else {
+			fbSig += "<anon>"
+		}
+		fbSig += "(...)" // Simplifié
+		if f.Type != nil && f.Type.Results != nil && len(f.Type.Results.List) > 0 {
+			fbSig += " (...)"
+		}
+		return fbSig
+	}
+	return strings.Join(strings.Fields(strings.ReplaceAll(buf.String(), "\n", " ")), " ")
+}
+
+// canonicalFuncType formate un type de fonction sans noms de paramètres ni de résultats,
+// ex: "func([]byte) (int, error)". Utilisé pour comparer des signatures structurellement.
+// Les paramètres de type sont dégroupés et renommés selon leur position, comme les paramètres
+// perdent leurs noms: func[T, U any](T) U et func[A any, B any](A) B donnent tous deux
+// "func[T0 any, T1 any](T0) T1".
+func canonicalFuncType(fset *token.FileSet, ft *ast.FuncType) string {
+	if ft == nil {
+		return "func()"
+	}
+	var rename map[string]string
+	var typeParams []string
+	if ft.TypeParams != nil {
+		rename = make(map[string]string)
+		for _, field := range ft.TypeParams.List {
+			for _, name := range field.Names {
+				rename[name.Name] = "T" + strconv.Itoa(len(rename))
+			}
+		}
+		for _, field := range ft.TypeParams.List {
+			constraint := canonicalRenamedType(fset, field.Type, rename)
+			for _, name := range field.Names {
+				typeParams = append(typeParams, rename[name.Name]+" "+constraint)
+			}
+		}
+	}
+	params := fieldListTypes(fset, ft.Params, rename)
+	results := fieldListTypes(fset, ft.Results, rename)
+	sig := "func"
+	if len(typeParams) > 0 {
+		sig += "[" + strings.Join(typeParams, ", ") + "]"
+	}
+	sig += "(" + strings.Join(params, ", ") + ")"
+	switch len(results) {
+	case 0:
+	case 1:
+		sig += " " + results[0]
+	default:
+		sig += " (" + strings.Join(results, ", ") + ")"
+	}
+	return sig
+}
+
+// fieldListTypes retourne le type formaté de chaque entrée d'une liste de champs,
+// en répétant le type pour les noms groupés (a, b int -> int, int) et en renommant les
+// paramètres de type selon rename (cf. canonicalFuncType).
+func fieldListTypes(fset *token.FileSet, fields *ast.FieldList, rename map[string]string) []string {
+	var types []string
+	if fields == nil {
+		return types
+	}
+	for _, field := range fields.List {
+		typeStr := canonicalRenamedType(fset, field.Type, rename)
+		count := len(field.Names)
+		if count == 0 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			types = append(types, typeStr)
+		}
+	}
+	return types
+}
+
+// apiFuncSignature retourne la forme canonique de l'API d'une fonction ou méthode exportée,
+// ex: "func Parse func(string) (T, error)" ou "method (*Set).Add func(T)", ou "" si elle
+// n'est pas exportée (une méthode l'est si son nom et son type receveur le sont).
+func apiFuncSignature(fset *token.FileSet, fd *ast.FuncDecl) string {
+	if !ast.IsExported(fd.Name.Name) {
+		return ""
+	}
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return "func " + fd.Name.Name + " " + canonicalFuncType(fset, fd.Type)
+	}
+	base, isPointer, _ := normalizeReceiverType(typeToString(fset, fd.Recv.List[0].Type))
+	if !ast.IsExported(base) {
+		return ""
+	}
+	if isPointer {
+		base = "*" + base
+	}
+	return "method (" + base + ")." + fd.Name.Name + " " + canonicalFuncType(fset, fd.Type)
+}
+
+// apiValueSignature retourne la forme canonique de l'API du i-ème nom d'une spécification
+// const/var exportée, ex: "const Max int = 10" ou "var ErrX = errors.New(...)", ou "" s'il
+// n'est pas exporté. La valeur d'une constante fait partie de l'API; celle d'une variable
+// n'y figure qu'à défaut de type déclaré, pour refléter le type inféré.
+func apiValueSignature(fset *token.FileSet, tok token.Token, spec *ast.ValueSpec, i int) string {
+	name := spec.Names[i].Name
+	if !ast.IsExported(name) {
+		return ""
+	}
+	sig := tok.String() + " " + name
+	if spec.Type != nil {
+		sig += " " + canonicalTypeString(fset, spec.Type)
+	}
+	if i < len(spec.Values) && (tok == token.CONST || spec.Type == nil) {
+		sig += " = " + strings.TrimSpace(formatNode(fset, spec.Values[i]))
+	}
+	return sig
+}
+
+// apiTypeSignature retourne la forme canonique de l'API d'un type exporté, ex:
+// "type Set[T comparable] struct{Items []T}", ou "" s'il n'est pas exporté. Les champs
+// nommés non exportés d'une struct sont retirés (invisibles hors du paquet); les champs
+// embarqués sont conservés car ils promeuvent leurs méthodes.
+func apiTypeSignature(fset *token.FileSet, spec *ast.TypeSpec) string {
+	if !ast.IsExported(spec.Name.Name) {
+		return ""
+	}
+	sig := "type " + spec.Name.Name
+	if spec.TypeParams != nil && len(spec.TypeParams.List) > 0 {
+		var typeParams []string
+		for _, field := range spec.TypeParams.List {
+			for _, name := range field.Names {
+				typeParams = append(typeParams, name.Name+" "+canonicalTypeString(fset, field.Type))
+			}
+		}
+		sig += "[" + strings.Join(typeParams, ", ") + "]"
+	}
+	if spec.Assign.IsValid() {
+		sig += " ="
+	}
+	typeExpr := spec.Type
+	if st, ok := typeExpr.(*ast.StructType); ok && st.Fields != nil {
+		exported := &ast.FieldList{}
+		for _, field := range st.Fields.List {
+			if len(field.Names) == 0 {
+				exported.List = append(exported.List, field)
+				continue
+			}
+			kept := &ast.Field{Type: field.Type, Tag: field.Tag}
+			for _, name := range field.Names {
+				if ast.IsExported(name.Name) {
+					kept.Names = append(kept.Names, name)
+				}
+			}
+			if len(kept.Names) > 0 {
+				exported.List = append(exported.List, kept)
+			}
+		}
+		typeExpr = &ast.StructType{Fields: exported}
+	}
+	return sig + " " + strings.Join(strings.Fields(canonicalTypeString(fset, typeExpr)), " ")
+}
+
+// canonicalTypeString formate un type sous forme normalisée: interface{} devient any et les
+// noms de paramètres des types fonction imbriqués sont retirés (func(x int) bool -> func(int) bool).
+func canonicalTypeString(fset *token.FileSet, expr ast.Expr) string {
+	typeStr := strings.ReplaceAll(typeToString(fset, expr), "interface{}", "any")
+	if !strings.Contains(typeStr, "func(") {
+		return typeStr
+	}
+	// Retravailler une copie re-parsée pour ne pas modifier l'AST d'origine.
+	copyExpr, err := parser.ParseExpr(typeStr)
+	if err != nil {
+		return typeStr
+	}
+	ast.Inspect(copyExpr, func(n ast.Node) bool {
+		if ft, ok := n.(*ast.FuncType); ok {
+			stripFieldNames(ft.Params)
+			stripFieldNames(ft.Results)
+		}
+		return true
+	})
+	return typeToString(token.NewFileSet(), copyExpr)
+}
+
+// canonicalRenamedType est canonicalTypeString après renommage des identifiants de type
+// selon rename, sur une copie re-parsée (l'AST d'origine n'est pas modifié). Les noms de
+// champs et de paramètres et les sélecteurs pkg.T ne sont pas renommés.
+func canonicalRenamedType(fset *token.FileSet, expr ast.Expr, rename map[string]string) string {
+	if len(rename) == 0 {
+		return canonicalTypeString(fset, expr)
+	}
+	copyExpr, err := parser.ParseExpr(typeToString(fset, expr))
+	if err != nil {
+		return canonicalTypeString(fset, expr)
+	}
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.Field:
+			ast.Inspect(e.Type, visit)
+			return false
+		case *ast.SelectorExpr:
+			return false
+		case *ast.Ident:
+			if name, ok := rename[e.Name]; ok {
+				e.Name = name
+			}
+		}
+		return true
+	}
+	ast.Inspect(copyExpr, visit)
+	return canonicalTypeString(token.NewFileSet(), copyExpr)
+}
+
+// stripFieldNames retire les noms d'une liste de paramètres en dupliquant les types groupés.
+func stripFieldNames(fields *ast.FieldList) {
+	if fields == nil {
+		return
+	}
+	var list []*ast.Field
+	for _, field := range fields.List {
+		for i := 0; i < len(field.Names) || i == 0; i++ {
+			list = append(list, &ast.Field{Type: field.Type})
+		}
+	}
+	fields.List = list
+}
+
+// interfaceMethodSet retourne les méthodes explicites d'une interface (nom -> type de
+// fonction canonique) et ses éléments embarqués formatés (ex: "Reader", "io.Writer", "~int | ~string").
+func interfaceMethodSet(fset *token.FileSet, iface *ast.InterfaceType) (map[string]string, []string) {
+	methods := make(map[string]string)
+	var embeds []string
+	if iface.Methods == nil {
+		return methods, embeds
+	}
+	for _, field := range iface.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			embeds = append(embeds, typeToString(fset, field.Type))
+			continue
+		}
+		for _, name := range field.Names {
+			methods[name.Name] = canonicalFuncType(fset, ft)
+		}
+	}
+	return methods, embeds
+}
+
+// interfaceMethodSigs décrit les méthodes explicites d'une interface dans l'ordre de déclaration;
+// les éléments embarqués sont exclus (cf. interfaceMethodSet).
+func interfaceMethodSigs(fset *token.FileSet, iface *ast.InterfaceType, logger Logger) []MethodSig {
+	if iface.Methods == nil {
+		return nil
+	}
+	var methods []MethodSig
+	for _, field := range iface.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			continue
+		}
+		doc := getDocstring(field.Doc)
+		if doc == "" {
+			doc = getDocstring(field.Comment)
+		}
+		for _, name := range field.Names {
+			methods = append(methods, MethodSig{
+				Name:      name.Name,
+				Signature: buildSignatureString(fset, &ast.FuncDecl{Name: name, Type: ft}, logger),
+				Doc:       doc,
+			})
+		}
+	}
+	return methods
+}
+
+// structFieldInfos décrit les champs d'une struct dans l'ordre de déclaration, ou nil si elle
+// n'en a pas. Un tag illisible est repris tel qu'écrit, backquotes ou guillemets compris.
+func structFieldInfos(fset *token.FileSet, st *ast.StructType) []FieldInfo {
+	if st.Fields == nil {
+		return nil
+	}
+	var fields []FieldInfo
+	for _, field := range st.Fields.List {
+		info := FieldInfo{Type: typeToString(fset, field.Type), Embedded: len(field.Names) == 0}
+		for _, name := range field.Names {
+			info.Names = append(info.Names, name.Name)
+		}
+		if field.Tag != nil {
+			info.Tag = field.Tag.Value
+			if tag, err := strconv.Unquote(field.Tag.Value); err == nil {
+				info.Tag = tag
+			}
+		}
+		info.Doc = getDocstring(field.Doc)
+		if info.Doc == "" {
+			info.Doc = getDocstring(field.Comment)
+		}
+		fields = append(fields, info)
+	}
+	return fields
+}
+
+// maxAnonStructDepth borne l'imbrication des structs anonymes décrites par -anon-struct-fields:
+// au-delà, un champ garde son Type formaté, sans Fields.
+const maxAnonStructDepth = 3
+
+// anonValueType retourne le type anonyme (struct ou interface) du nom i d'une spécification
+// var: le type déclaré, à défaut celui du littéral composite de sa valeur (struct{...}{},
+// &struct{...}{}). Les pointeurs, tableaux, slices et valeurs de map sont traversés, pour
+// les tables de cas ([]struct{...}{...}). Retourne nil pour un type nommé.
+func anonValueType(spec *ast.ValueSpec, i int) ast.Expr {
+	expr := spec.Type
+	if expr == nil && i < len(spec.Values) {
+		value := spec.Values[i]
+		if unary, ok := value.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+			value = unary.X
+		}
+		if lit, ok := value.(*ast.CompositeLit); ok {
+			expr = lit.Type
+		}
+	}
+	return anonElemType(expr)
+}
+
+// anonElemType traverse pointeurs, tableaux, slices, valeurs de map et parenthèses jusqu'à une
+// struct ou une interface anonyme, ou retourne nil.
+func anonElemType(expr ast.Expr) ast.Expr {
+	for {
+		switch t := expr.(type) {
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.ArrayType:
+			expr = t.Elt
+		case *ast.MapType:
+			expr = t.Value
+		case *ast.StructType, *ast.InterfaceType:
+			return t
+		default:
+			return nil
+		}
+	}
+}
+
+// anonStructFieldInfos décrit les champs de st comme structFieldInfos, et ceux des structs
+// anonymes de ses champs jusqu'à maxAnonStructDepth niveaux (depth est celui de st).
+func anonStructFieldInfos(fset *token.FileSet, st *ast.StructType, depth int) []FieldInfo {
+	fields := structFieldInfos(fset, st)
+	if depth >= maxAnonStructDepth {
+		return fields
+	}
+	for i, field := range st.Fields.List {
+		if nested, ok := anonElemType(field.Type).(*ast.StructType); ok {
+			fields[i].Fields = anonStructFieldInfos(fset, nested, depth+1)
+		}
+	}
+	return fields
+}
+
+// structMembers retourne les noms des champs d'une struct (un champ embarqué porte le nom de
+// son type) et les noms de base des types embarqués non qualifiés: T, *T, T[int].
+func structMembers(st *ast.StructType) (fields, embeds []string) {
+	if st.Fields == nil {
+		return nil, nil
+	}
+	for _, field := range st.Fields.List {
+		if len(field.Names) > 0 {
+			for _, name := range field.Names {
+				fields = append(fields, name.Name)
+			}
+			continue
+		}
+		expr := field.Type
+		if star, ok := expr.(*ast.StarExpr); ok {
+			expr = star.X
+		}
+		switch e := expr.(type) {
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		}
+		switch e := expr.(type) {
+		case *ast.Ident:
+			fields = append(fields, e.Name)
+			embeds = append(embeds, e.Name)
+		case *ast.SelectorExpr:
+			fields = append(fields, e.Sel.Name) // Type d'un autre paquet: méthodes inconnues
+		}
+	}
+	return fields, embeds
+}
+
+// receiverBaseName retourne le nom de base d'un type receveur: "*Foo[T]" -> "Foo".
+func receiverBaseName(receiverType string) string {
+	base, _, _ := normalizeReceiverType(receiverType)
+	return base
+}
+
+// receiverHasTypeParams indique si l'expression de type d'un receveur instancie des
+// paramètres de type (Foo[T], *Foo[K, V]), c.-à-d. si la méthode appartient à un type générique.
+func receiverHasTypeParams(expr ast.Expr) bool {
+	for {
+		switch e := expr.(type) {
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr, *ast.IndexListExpr:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// typeParamList retourne les paramètres de type d'une liste [K comparable, V any], un par nom.
+func typeParamList(fset *token.FileSet, list *ast.FieldList) []TypeParam {
+	if list == nil {
+		return nil
+	}
+	var params []TypeParam
+	for _, field := range list.List {
+		constraint := typeToString(fset, field.Type)
+		for _, name := range field.Names {
+			params = append(params, TypeParam{Name: name.Name, Constraint: constraint})
+		}
+	}
+	return params
+}
+
+// receiverTypeParams retourne les paramètres de type nommés par un receveur générique
+// ((s *Set[T]) -> T), sans contrainte: elle est déclarée sur le type, cf. resolveReceiverConstraints.
+func receiverTypeParams(expr ast.Expr) []TypeParam {
+	for {
+		switch e := expr.(type) {
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			return identTypeParams([]ast.Expr{e.Index})
+		case *ast.IndexListExpr:
+			return identTypeParams(e.Indices)
+		default:
+			return nil
+		}
+	}
+}
+
+func identTypeParams(indices []ast.Expr) []TypeParam {
+	var params []TypeParam
+	for _, index := range indices {
+		if ident, ok := index.(*ast.Ident); ok {
+			params = append(params, TypeParam{Name: ident.Name})
+		}
+	}
+	return params
+}
+
+// normalizeReceiverType décompose un type receveur formaté en nom de base, indicateur de
+// pointeur et liste de paramètres de type: "*Foo[K, V]" -> ("Foo", true, "[K, V]").
+// Les parenthèses superflues ("(*Foo)") sont ignorées.
+func normalizeReceiverType(receiverType string) (base string, isPointer bool, typeParams string) {
+	base = strings.TrimSpace(receiverType)
+	for strings.HasPrefix(base, "(") || strings.HasPrefix(base, "*") {
+		if base[0] == '*' {
+			isPointer = true
+		}
+		base = strings.TrimSpace(base[1:])
+	}
+	base = strings.TrimRight(base, ") ")
+	if idx := strings.Index(base, "["); idx >= 0 {
+		typeParams = base[idx:]
+		base = base[:idx]
+	}
+	return strings.TrimSpace(base), isPointer, typeParams
+}
+
+// packageKey identifie le paquet d'un fragment: répertoire (PackageDir) + nom du paquet.
+func packageKey(info FragmentInfo) string {
+	return info.PackageDir + ":" + info.PackageName
+}
+
+func typeToString(fset *token.FileSet, expr ast.Expr) string {
+	if expr == nil {
+		return "<!nil expr!>"
+	}
+	return strings.TrimSpace(formatNode(fset, expr))
+}
+
+func formatNode(fset *token.FileSet, node ast.Node) string {
+	if node == nil {
+		return "<!nil node!>"
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, node); err != nil {
+		if ident, ok := node.(*ast.Ident); ok {
+			return ident.Name
+		} // Fallback pour identifiants simples
+		// Log discret pour les erreurs de formatage de nœuds internes, peut être bruyant
+		// fmt.Fprintf(os.Stderr, "[AST Parser] DEBUG: Erreur format.Node pour type %T: %v\n", node, err)
+		return "<!format error!>"
+	}
+	return buf.String()
+}
+
+// sanitizePathForID normalise un chemin relatif pour l'inclure dans un ID de fragment:
+// les séparateurs "/" sont conservés, les caractères hors [A-Za-z0-9._-] deviennent "_".
+func sanitizePathForID(p string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '.' || r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, p)
+}
+
+func sanitizeIdentifier(s string) string {
+	if s == "" {
+		return "emptystr"
+	}
+	var result strings.Builder
+	for i, r := range s {
+		if unicode.IsLetter(r) || (unicode.IsDigit(r) && i > 0) { // Les identifiants ne commencent pas par un chiffre
+			result.WriteRune(r)
+		} else if r == '*' {
+			result.WriteString("Ptr")
+		} else if r == '[' && i+1 < len(s) && s[i+1] == ']' { // Gérer `[]`
+			result.WriteString("Slice")
+			// On pourrait avancer l'index i ici si on traitait une slice de runes, mais avec range sur string, c'est ok.
+		} else if r == ']' {
+			// Ignoré, géré par le `[]`
+		} else if r == '.' { // Remplacer `.` par `_`
+			result.WriteRune('_')
+		} else if r == '_' { // Conserver les underscores
+			result.WriteRune('_')
+		}
+		// Ignorer les autres caractères
+	}
+	sanitized := result.String()
+	// Nettoyage des underscores multiples et de début/fin
+	for strings.Contains(sanitized, "__") {
+		sanitized = strings.ReplaceAll(sanitized, "__", "_")
+	}
+	sanitized = strings.Trim(sanitized, "_")
+
+	if sanitized == "" { // Si tout a été strippé
+		// Fallback simple basé sur un hash court si la sanitization donne une chaîne vide.
+		// Alternative à base64 pour éviter l'import si pas d'autres usages.
+		h := sha1.New()
+		h.Write([]byte(s))
+		return fmt.Sprintf("invalidident_%s", hex.EncodeToString(h.Sum(nil)[:4]))
+	}
+	return sanitized
+}
@@ -0,0 +1,1274 @@
+// code/manifest/bin/astparser/astparser_test.go
+package astparser
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"gopkg.in/yaml.v3"
+)
+
+// sampleTree est un petit module de plusieurs paquets: deux a.go homonymes dans des dossiers
+// différents, des imports non triés, des appels entre fichiers et entre paquets.
+var sampleTree = map[string]string{
+	"go.mod": "module example.com/sample\n\ngo 1.22\n",
+	"pkg/a/a.go": `package a
+
+import (
+	"strings"
+	"fmt"
+)
+
+// Greet salue name.
+func Greet(name string) string {
+	return fmt.Sprintf("bonjour %s", normalize(name))
+}
+
+func normalize(name string) string {
+	return strings.TrimSpace(name)
+}
+`,
+	"pkg/a/b.go": `package a
+
+// Counter compte.
+type Counter struct {
+	N int
+}
+
+// Inc incrémente le compteur.
+func (c *Counter) Inc() { c.N++ }
+`,
+	"pkg/b/a.go": `package a
+
+import "example.com/sample/pkg/a"
+
+// Twice salue deux fois.
+func Twice(name string) string {
+	return a.Greet(name) + a.Greet(name)
+}
+`,
+	"cmd/app/main.go": `package main
+
+import (
+	"os"
+	b "example.com/sample/pkg/b"
+	"fmt"
+)
+
+func main() {
+	fmt.Fprintln(os.Stdout, b.Twice("monde"))
+}
+`,
+}
+
+// writeTree crée les fichiers donnés (chemin relatif à barres obliques -> contenu) dans un
+// dossier temporaire et retourne ce dossier.
+func writeTree(tb testing.TB, files map[string]string) string {
+	tb.Helper()
+	root := tb.TempDir()
+	for rel, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return root
+}
+
+// quietOptions retourne DefaultOptions sans messages de progression.
+func quietOptions() Options {
+	opts := DefaultOptions()
+	opts.Logger = log.New(io.Discard, "", 0)
+	return opts
+}
+
+// runOutput exécute Run sur root et retourne ce qu'il écrit.
+func runOutput(tb testing.TB, root string, opts Options) []byte {
+	tb.Helper()
+	var out bytes.Buffer
+	if err := Run(root, opts, &out); err != nil {
+		tb.Fatalf("Run: %v", err)
+	}
+	return out.Bytes()
+}
+
+// parseTree exécute ParseProject sur root et échoue le test en cas d'erreur.
+func parseTree(tb testing.TB, root string, opts Options) FragmentManifest {
+	tb.Helper()
+	manifest, err := ParseProject(root, opts)
+	if err != nil {
+		tb.Fatalf("ParseProject: %v", err)
+	}
+	return manifest
+}
+
+// fragmentByName retourne le fragment d'identifiant name du fichier originalPath.
+func fragmentByName(tb testing.TB, manifest FragmentManifest, originalPath, name string) (string, FragmentInfo) {
+	tb.Helper()
+	for id, info := range manifest.Fragments {
+		if info.OriginalPath == originalPath && info.Identifier == name {
+			return id, info
+		}
+	}
+	tb.Fatalf("fragment %s absent de %s", name, originalPath)
+	return "", FragmentInfo{}
+}
+
+func TestOutputIsDeterministic(t *testing.T) {
+	root := writeTree(t, sampleTree)
+	opts := quietOptions()
+	first := runOutput(t, root, opts)
+	second := runOutput(t, root, opts)
+	if !bytes.Equal(first, second) {
+		t.Fatalf("deux analyses du même arbre diffèrent:\n%s\n---\n%s", first, second)
+	}
+}
+
+func TestStdinOrderDoesNotChangeOutput(t *testing.T) {
+	root := writeTree(t, sampleTree)
+	files := []string{"pkg/a/a.go", "pkg/a/b.go", "pkg/b/a.go", "cmd/app/main.go"}
+	opts := quietOptions()
+	opts.StdinFiles = true
+	opts.Stdin = strings.NewReader(strings.Join(files, "\n"))
+	want := runOutput(t, root, opts)
+	// Ordre inversé, doublon et chemin absolu: même manifeste.
+	shuffled := []string{files[3], files[1], filepath.Join(root, "pkg/b/a.go"), files[0], files[3]}
+	opts.Stdin = strings.NewReader(strings.Join(shuffled, "\n"))
+	if got := runOutput(t, root, opts); !bytes.Equal(got, want) {
+		t.Fatalf("la sortie dépend de l'ordre de -stdin:\n%s\n---\n%s", got, want)
+	}
+}
+
+func TestSameNamedFilesInDifferentDirsKeepDistinctIDs(t *testing.T) {
+	root := writeTree(t, sampleTree)
+	manifest := parseTree(t, root, quietOptions())
+	greetID, _ := fragmentByName(t, manifest, "pkg/a/a.go", "Greet")
+	twiceID, _ := fragmentByName(t, manifest, "pkg/b/a.go", "Twice")
+	if strings.Contains(greetID, dirHashSuffix("pkg/a")) {
+		t.Errorf("le dossier le moins profond garde ses IDs sans suffixe: %s", greetID)
+	}
+	if want := dirHashSuffix("pkg/b"); !strings.Contains(twiceID, want) {
+		t.Errorf("ID %s sans le suffixe %s de pkg/b", twiceID, want)
+	}
+
+	// Le même ID, que pkg/b/a.go soit analysé seul (-stdin) ou qu'un homonyme plus profond existe.
+	opts := quietOptions()
+	opts.StdinFiles = true
+	opts.Stdin = strings.NewReader("pkg/b/a.go\n")
+	if id, _ := fragmentByName(t, parseTree(t, root, opts), "pkg/b/a.go", "Twice"); id != twiceID {
+		t.Errorf("ID sous -stdin = %s, attendu %s", id, twiceID)
+	}
+	deeper := map[string]string{"pkg/c/d/a.go": "package a\n\nfunc Other() {}\n"}
+	for rel, content := range sampleTree {
+		deeper[rel] = content
+	}
+	manifest = parseTree(t, writeTree(t, deeper), quietOptions())
+	if id, _ := fragmentByName(t, manifest, "pkg/b/a.go", "Twice"); id != twiceID {
+		t.Errorf("ID avec un homonyme plus profond = %s, attendu %s", id, twiceID)
+	}
+	if id, _ := fragmentByName(t, manifest, "pkg/a/a.go", "Greet"); id != greetID {
+		t.Errorf("ID avec un homonyme plus profond = %s, attendu %s", id, greetID)
+	}
+}
+
+// callsTree a un paquet qui se vérifie (ok) et deux paquets en erreur de types (broken, cyc).
+var callsTree = map[string]string{
+	"go.mod": "module example.com/calls\n\ngo 1.22\n",
+	"ok/ok.go": `package ok
+
+type T struct{}
+
+func (T) M() {}
+
+func Run() {
+	first()
+	second()
+	T{}.M()
+}
+
+func first()  {}
+func second() {}
+`,
+	// broken et cyc s'importent l'un l'autre: la vérification de cyc échoue sur le cycle et
+	// go/types ne résout pas broken.Helper.
+	"broken/broken.go": `package broken
+
+import "example.com/calls/cyc"
+
+var _ = cyc.Run
+
+func Helper() {}
+`,
+	"cyc/cyc.go": `package cyc
+
+import "example.com/calls/broken"
+
+type T struct{}
+
+func (T) M() {}
+
+func Run() {
+	broken.Helper()
+	local()
+	T{}.M()
+}
+
+func local() {}
+`,
+}
+
+// callNames retourne les identifiants des fragments appelés par le fragment id.
+func callNames(manifest FragmentManifest, id string) []string {
+	var names []string
+	for _, callee := range manifest.Fragments[id].DirectCallsInternal {
+		names = append(names, manifest.Fragments[callee].Identifier)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDirectCallsInternalListsLocalHelpers(t *testing.T) {
+	manifest := parseTree(t, writeTree(t, callsTree), quietOptions())
+	id, _ := fragmentByName(t, manifest, "ok/ok.go", "Run")
+	if got, want := callNames(manifest, id), []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("appels de Run = %v, attendu %v", got, want)
+	}
+}
+
+func TestTypeCheckFallsBackToNamesOnTypeErrors(t *testing.T) {
+	opts := quietOptions()
+	opts.TypeCheck = true
+	manifest := parseTree(t, writeTree(t, callsTree), opts)
+	// Paquet vérifié: go/types résout aussi l'appel de méthode.
+	id, _ := fragmentByName(t, manifest, "ok/ok.go", "Run")
+	if got, want := callNames(manifest, id), []string{"M", "first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("appels de ok.Run = %v, attendu %v", got, want)
+	}
+	// Paquet en erreur: les appels résolus par noms restent, complétés par go/types (M).
+	id, _ = fragmentByName(t, manifest, "cyc/cyc.go", "Run")
+	if got, want := callNames(manifest, id), []string{"Helper", "M", "local"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("appels de cyc.Run = %v, attendu %v", got, want)
+	}
+}
+
+func TestSpillResolvesCallAndTypeEdges(t *testing.T) {
+	root := writeTree(t, sampleTree)
+	var want, got FragmentManifest
+	if err := json.Unmarshal(runOutput(t, root, quietOptions()), &want); err != nil {
+		t.Fatal(err)
+	}
+	opts := quietOptions()
+	opts.SpillDir = t.TempDir()
+	opts.SpillThreshold = 1
+	if err := json.Unmarshal(runOutput(t, root, opts), &got); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := fragmentByName(t, want, "pkg/a/a.go", "Greet")
+	if len(want.Fragments[id].DirectCallsInternal) == 0 {
+		t.Fatalf("Greet sans appels internes: l'arbre ne teste rien")
+	}
+	for id, info := range want.Fragments {
+		spilled := got.Fragments[id]
+		if !reflect.DeepEqual(spilled.DirectCallsInternal, info.DirectCallsInternal) {
+			t.Errorf("%s: direct_calls_internal = %v sous -spill-dir, attendu %v", id, spilled.DirectCallsInternal, info.DirectCallsInternal)
+		}
+		if !reflect.DeepEqual(spilled.TypesUsedInternal, info.TypesUsedInternal) {
+			t.Errorf("%s: types_used_internal = %v sous -spill-dir, attendu %v", id, spilled.TypesUsedInternal, info.TypesUsedInternal)
+		}
+	}
+}
+
+func TestAnonStructFieldsOnVars(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/anon\n\ngo 1.22\n",
+		"conf.go": `package anon
+
+var Config = struct {
+	Addr string ` + "`json:\"addr\"`" + `
+	TLS  struct {
+		Cert string
+		Deep struct {
+			Level3 struct{ Level4 struct{ X int } }
+		}
+	}
+}{}
+
+var cases = []struct{ in, want string }{{"a", "b"}}
+
+var Reader interface{ Read(p []byte) (int, error) }
+
+var Plain = 3
+`,
+	})
+	opts := quietOptions()
+	opts.AnonStructFields = true
+	manifest := parseTree(t, root, opts)
+
+	_, config := fragmentByName(t, manifest, "conf.go", "Config")
+	if len(config.Fields) != 2 || config.Fields[0].Tag != `json:"addr"` {
+		t.Fatalf("champs de Config = %+v", config.Fields)
+	}
+	tls := config.Fields[1]
+	if len(tls.Fields) != 2 || tls.Fields[1].Names[0] != "Deep" {
+		t.Fatalf("champs de TLS = %+v", tls.Fields)
+	}
+	// Config est au niveau 1: Deep (niveau 3) garde ses champs, Level3 s'arrête à son Type.
+	deep := tls.Fields[1]
+	if len(deep.Fields) != 1 || deep.Fields[0].Fields != nil || deep.Fields[0].Type == "" {
+		t.Errorf("profondeur non bornée: %+v", deep.Fields)
+	}
+
+	_, cases := fragmentByName(t, manifest, "conf.go", "cases")
+	if len(cases.Fields) != 1 || !reflect.DeepEqual(cases.Fields[0].Names, []string{"in", "want"}) {
+		t.Errorf("champs de cases = %+v", cases.Fields)
+	}
+	_, reader := fragmentByName(t, manifest, "conf.go", "Reader")
+	if len(reader.Methods) != 1 || reader.Methods[0].Name != "Read" {
+		t.Errorf("méthodes de Reader = %+v", reader.Methods)
+	}
+	if _, plain := fragmentByName(t, manifest, "conf.go", "Plain"); plain.Fields != nil || plain.Methods != nil {
+		t.Errorf("Plain n'est pas anonyme: %+v", plain)
+	}
+
+	// Sans l'option, les variables restent sans champs.
+	_, config = fragmentByName(t, parseTree(t, root, quietOptions()), "conf.go", "Config")
+	if config.Fields != nil {
+		t.Errorf("fields sans -anon-struct-fields: %+v", config.Fields)
+	}
+}
+
+func TestResolveConstValues(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/consts\n\ngo 1.22\n",
+		"status.go": `package consts
+
+import "time"
+
+type Status int
+
+const (
+	StatusUnknown Status = iota
+	StatusActive
+)
+
+const Name = "serveur" + "-1"
+
+const Timeout = 2 * time.Second
+
+const Ratio = 1.0 / 4
+
+const Broken = undefined + 1
+`,
+	})
+	opts := quietOptions()
+	opts.ResolveConstValues = true
+	manifest := parseTree(t, root, opts)
+	for name, want := range map[string]string{
+		"StatusActive": "1",
+		"Name":         `"serveur-1"`,
+		"Timeout":      "2000000000",
+		"Ratio":        "0.25",
+		"Broken":       "",
+	} {
+		if _, info := fragmentByName(t, manifest, "status.go", name); info.ResolvedValue != want {
+			t.Errorf("%s: resolved_value = %q, attendu %q", name, info.ResolvedValue, want)
+		}
+	}
+
+	opts.GroupConstBlocks = true
+	_, group := fragmentByName(t, parseTree(t, root, opts), "status.go", "StatusUnknown")
+	if len(group.Members) != 2 || group.Members[0].ResolvedValue != "0" || group.Members[1].ResolvedValue != "1" {
+		t.Errorf("membres = %+v", group.Members)
+	}
+}
+
+func TestEmbedPatternsOnVars(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/assets\n\ngo 1.22\n",
+		"assets.go": "package assets\n\nimport \"embed\"\n\n" +
+			"//go:embed static/*.css \"mon fichier.txt\"\n" +
+			"//go:embed `templates/index.html`\n" +
+			"var Static embed.FS\n\n" +
+			"var (\n" +
+			"\t//go:embed version.txt\n" +
+			"\tVersion string\n\n" +
+			"\t// Logo est le logo.\n" +
+			"\t//go:embed logo.png\n" +
+			"\tLogo []byte\n\n" +
+			"\tPlain = 1\n" +
+			")\n",
+	})
+	manifest := parseTree(t, root, quietOptions())
+	for name, want := range map[string][]string{
+		"Static":  {"static/*.css", "mon fichier.txt", "templates/index.html"},
+		"Version": {"version.txt"},
+		"Logo":    {"logo.png"},
+		"Plain":   nil,
+	} {
+		if _, info := fragmentByName(t, manifest, "assets.go", name); !reflect.DeepEqual(info.EmbedPatterns, want) {
+			t.Errorf("%s: embed_patterns = %q, attendu %q", name, info.EmbedPatterns, want)
+		}
+	}
+	if _, logo := fragmentByName(t, manifest, "assets.go", "Logo"); logo.Docstring != "Logo est le logo." {
+		t.Errorf("la directive ne doit pas entrer dans la docstring: %q", logo.Docstring)
+	}
+}
+
+func TestTestExportsAreFlaggedAndNotExported(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"go.mod":         "module example.com/cache\n\ngo 1.22\n",
+		"cache.go":       "package cache\n\nfunc Get() {}\n\nfunc evict() {}\n",
+		"export_test.go": "package cache\n\nvar Evict = evict\n\nfunc ResetForTest() {}\n",
+		"cache_test.go":  "package cache\n\nimport \"testing\"\n\nfunc TestGet(t *testing.T) { Get() }\n",
+	})
+	opts := quietOptions()
+	opts.IncludeTests = true
+	manifest := parseTree(t, root, opts)
+	if _, info := fragmentByName(t, manifest, "export_test.go", "ResetForTest"); !info.IsTestExport || !info.IsTest {
+		t.Errorf("ResetForTest: is_test_export = %v, is_test = %v", info.IsTestExport, info.IsTest)
+	}
+	if _, info := fragmentByName(t, manifest, "cache_test.go", "TestGet"); info.IsTestExport {
+		t.Errorf("TestGet n'est pas dans export_test.go")
+	}
+
+	opts.ExportedOnly = true
+	for _, info := range parseTree(t, root, opts).Fragments {
+		if info.OriginalPath == "export_test.go" {
+			t.Errorf("-exported-only garde %s de export_test.go", info.Identifier)
+		}
+	}
+}
+
+// syntheticTree génère un module de n fichiers répartis en paquets de 20 fichiers, avec des
+// types, des méthodes, des appels entre fichiers et de longues chaînes (lignes NDJSON longues).
+func syntheticTree(n int) map[string]string {
+	files := map[string]string{"go.mod": "module example.com/synthetic\n\ngo 1.22\n"}
+	for i := 0; i < n; i++ {
+		pkg := fmt.Sprintf("pkg%02d", i/20)
+		var src strings.Builder
+		fmt.Fprintf(&src, "package %s\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n)\n\n", pkg)
+		fmt.Fprintf(&src, "// T%d est un type généré.\ntype T%d struct {\n\tName string\n\tN    int\n}\n\n", i, i)
+		fmt.Fprintf(&src, "// Describe décrit T%d.\nfunc (t *T%d) Describe() string {\n\treturn fmt.Sprintf(%q, t.Name, F%d(t.N))\n}\n\n",
+			i, i, "%s "+strings.Repeat("x", 200)+" %d", i)
+		fmt.Fprintf(&src, "// F%d calcule.\nfunc F%d(n int) int {\n\tif n <= 0 {\n\t\treturn len(strings.TrimSpace(%q))\n\t}\n\treturn F%d(n-1) + helper%d(n)\n}\n\n",
+			i, i, strings.Repeat("y", 100), i, i)
+		fmt.Fprintf(&src, "func helper%d(n int) int {\n\tfor i := 0; i < n; i++ {\n\t\tn += i\n\t}\n\treturn n\n}\n", i)
+		if i%20 > 0 {
+			fmt.Fprintf(&src, "\nfunc Chain%d() int { return F%d(1) }\n", i, i-1)
+		}
+		files[fmt.Sprintf("%s/file%03d.go", pkg, i)] = src.String()
+	}
+	return files
+}
+
+// serialWriter compte les appels à Write qui se chevauchent.
+type serialWriter struct {
+	active, overlaps int32
+	buf              bytes.Buffer
+}
+
+func (w *serialWriter) Write(p []byte) (int, error) {
+	if atomic.AddInt32(&w.active, 1) > 1 {
+		atomic.AddInt32(&w.overlaps, 1)
+	}
+	defer atomic.AddInt32(&w.active, -1)
+	return w.buf.Write(p)
+}
+
+func TestNDJSONLinesAreWholeUnderConcurrency(t *testing.T) {
+	root := writeTree(t, syntheticTree(200))
+	opts := quietOptions()
+	opts.NDJSON = true
+	opts.Jobs = 32
+	var w serialWriter
+	if err := Run(root, opts, &w); err != nil {
+		t.Fatal(err)
+	}
+	if w.overlaps > 0 {
+		t.Fatalf("%d écriture(s) concurrente(s) dans la sortie", w.overlaps)
+	}
+	lines := strings.Split(strings.TrimSuffix(w.buf.String(), "\n"), "\n")
+	seen := make(map[string]bool)
+	for i, line := range lines {
+		var entry FragmentEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("ligne %d invalide (%v): %.120s", i+1, err, line)
+		}
+		if entry.ID == "" || seen[entry.ID] {
+			t.Fatalf("ligne %d: ID vide ou répété %q", i+1, entry.ID)
+		}
+		seen[entry.ID] = true
+	}
+	// 200 fichiers: un type, une méthode, deux fonctions, et Chain sauf en tête de paquet.
+	if want := 200*4 + 190; len(lines) != want {
+		t.Errorf("%d ligne(s), attendu %d", len(lines), want)
+	}
+
+	opts.Jobs = 1
+	if serial := runOutput(t, root, opts); !bytes.Equal(serial, w.buf.Bytes()) {
+		t.Errorf("la sortie NDJSON dépend de -j")
+	}
+}
+
+func TestImportsKeepSourceOrderWhateverJobs(t *testing.T) {
+	root := writeTree(t, sampleTree)
+	want := map[string][]ImportInfo{
+		"pkg/a/a.go":      {{Path: "strings"}, {Path: "fmt"}},
+		"cmd/app/main.go": {{Path: "os"}, {Name: "b", Path: "example.com/sample/pkg/b"}, {Path: "fmt"}},
+	}
+	for _, jobs := range []int{1, 8} {
+		opts := quietOptions()
+		opts.Jobs = jobs
+		manifest := parseTree(t, root, opts)
+		fragmentByName(t, manifest, "pkg/a/a.go", "Greet")
+		fragmentByName(t, manifest, "cmd/app/main.go", "main")
+		for file, imports := range want {
+			for id, info := range manifest.Fragments {
+				if info.OriginalPath == file && !reflect.DeepEqual(info.Imports, imports) {
+					t.Errorf("-j %d: imports de %s = %+v, attendu %+v", jobs, id, info.Imports, imports)
+				}
+			}
+		}
+	}
+}
+
+// benchmarkRepo mesure séparément, sur un arbre généré de n fichiers, l'analyse complète et
+// ses étapes: parcours seul (-dry-run), analyse d'un fichier (-stdin), digests du contenu et
+// écriture JSON du manifeste.
+func benchmarkRepo(b *testing.B, n int) {
+	files := syntheticTree(n)
+	root := writeTree(b, files)
+	b.Run("full", func(b *testing.B) {
+		opts := quietOptions()
+		for i := 0; i < b.N; i++ {
+			if err := Run(root, opts, io.Discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("walk", func(b *testing.B) {
+		opts := quietOptions()
+		opts.DryRun = true
+		for i := 0; i < b.N; i++ {
+			if err := Run(root, opts, io.Discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("parse-file", func(b *testing.B) {
+		opts := quietOptions()
+		opts.StdinFiles = true
+		for i := 0; i < b.N; i++ {
+			opts.Stdin = strings.NewReader("pkg00/file001.go\n")
+			if _, err := ParseProject(root, opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("digest", func(b *testing.B) {
+		opts := quietOptions()
+		var size int64
+		for _, content := range files {
+			size += int64(len(content))
+		}
+		b.SetBytes(size)
+		for i := 0; i < b.N; i++ {
+			for _, content := range files {
+				opts.contentDigest([]byte(content))
+			}
+		}
+	})
+	b.Run("marshal", func(b *testing.B) {
+		manifest := parseTree(b, root, quietOptions())
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := printJSON(io.Discard, manifest); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkParseSmallRepo(b *testing.B) { benchmarkRepo(b, 20) }
+
+func BenchmarkParseLargeRepo(b *testing.B) { benchmarkRepo(b, 1000) }
+
+func TestParallelOutputMatchesSerial(t *testing.T) {
+	files := syntheticTree(100)
+	for rel, content := range sampleTree {
+		if rel != "go.mod" {
+			files["sample/"+rel] = content
+		}
+	}
+	root := writeTree(t, files)
+	opts := quietOptions()
+	opts.Jobs = 1
+	serial := runOutput(t, root, opts)
+	opts.Jobs = 8
+	for i := 0; i < 3; i++ {
+		if parallel := runOutput(t, root, opts); !bytes.Equal(parallel, serial) {
+			t.Fatalf("-j 8 diffère de -j 1 (essai %d)", i+1)
+		}
+	}
+}
+
+func BenchmarkParseSerialVsParallel(b *testing.B) {
+	root := writeTree(b, syntheticTree(500))
+	for _, jobs := range []int{1, 8} {
+		b.Run(fmt.Sprintf("j=%d", jobs), func(b *testing.B) {
+			opts := quietOptions()
+			opts.Jobs = jobs
+			for i := 0; i < b.N; i++ {
+				if err := Run(root, opts, io.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestTemplCommentAboveRootFallsBackToGoFile(t *testing.T) {
+	outer := writeTree(t, map[string]string{
+		"outside.templ": "package views\n",
+		"proj/go.mod":   "module example.com/proj\n\ngo 1.22\n",
+		"proj/views/page_templ.go": "// Code generated by templ - DO NOT EDIT.\n// File: ../outside.templ\n\npackage views\n\n" +
+			"func Page() string { return \"page\" }\n",
+	})
+	var logs bytes.Buffer
+	opts := quietOptions()
+	opts.Logger = log.New(&logs, "", 0)
+	manifest := parseTree(t, filepath.Join(outer, "proj"), opts)
+	_, page := fragmentByName(t, manifest, "views/page_templ.go", "Page")
+	if page.IsTemplSource || page.ActualSourcePath != "views/page_templ.go" {
+		t.Errorf("source = %q (templ: %v), attendu le _templ.go", page.ActualSourcePath, page.IsTemplSource)
+	}
+	if !strings.Contains(logs.String(), "hors de la racine du projet") {
+		t.Errorf("pas d'avertissement pour le chemin hors racine:\n%s", logs.String())
+	}
+}
+
+func TestCommentDensityCountsLineAndBlockComments(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/density\n\ngo 1.22\n",
+		"f.go": `package density
+
+func F() int {
+	// Commentaire de ligne.
+	/* Commentaire de bloc
+	   sur trois
+	   lignes. */
+	return 1 // En fin de ligne.
+}
+
+func G() int {
+	return 2
+}
+`,
+	})
+	opts := quietOptions()
+	opts.CommentDensity = true
+	manifest := parseTree(t, root, opts)
+	// F couvre 7 lignes dont 5 portent un commentaire (ligne, bloc de 3 lignes, fin de ligne).
+	if _, f := fragmentByName(t, manifest, "f.go", "F"); f.CommentLines != 5 || f.CommentDensity != 5.0/7 {
+		t.Errorf("F: comment_lines = %d, comment_density = %v, attendu 5 et %v", f.CommentLines, f.CommentDensity, 5.0/7)
+	}
+	if _, g := fragmentByName(t, manifest, "f.go", "G"); g.CommentLines != 0 || g.CommentDensity != 0 {
+		t.Errorf("G: comment_lines = %d, comment_density = %v", g.CommentLines, g.CommentDensity)
+	}
+}
+
+func TestPossibleLockLeak(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/locks\n\ngo 1.22\n",
+		"store.go": `package locks
+
+import "sync"
+
+type Store struct {
+	mu   sync.RWMutex
+	data map[string]int
+}
+
+func (s *Store) Get(k string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data[k]
+}
+
+func (s *Store) Set(k string, v int) {
+	s.mu.Lock()
+	defer func() { s.mu.Unlock() }()
+	s.data[k] = v
+}
+
+func (s *Store) Leak(k string) {
+	s.mu.Lock()
+	delete(s.data, k)
+}
+
+func (s *Store) WrongRelease() {
+	s.mu.RLock()
+	defer s.mu.Unlock()
+}
+`,
+	})
+	opts := quietOptions()
+	opts.DetectLockLeaks = true
+	manifest := parseTree(t, root, opts)
+	for name, want := range map[string]bool{"Get": false, "Set": false, "Leak": true, "WrongRelease": true} {
+		if _, info := fragmentByName(t, manifest, "store.go", name); info.PossibleLockLeak != want {
+			t.Errorf("%s: possible_lock_leak = %v, attendu %v", name, info.PossibleLockLeak, want)
+		}
+	}
+}
+
+func TestBlankReceiverAndParamsAreKept(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/blank\n\ngo 1.22\n",
+		"blank.go": `package blank
+
+type Foo struct{}
+
+func (_ Foo) M(_ int, name string) (_ error) { return nil }
+
+func (_ *Foo) P(_, _ string) {}
+
+func F(_ int) {}
+`,
+	})
+	manifest := parseTree(t, root, quietOptions())
+	for name, want := range map[string]struct{ receiver, signature string }{
+		"M": {"Foo", "func (_ Foo) M(_ int, name string) (_ error)"},
+		"P": {"*Foo", "func (_ *Foo) P(_, _ string)"},
+		"F": {"", "func F(_ int)"},
+	} {
+		_, info := fragmentByName(t, manifest, "blank.go", name)
+		if info.ReceiverType != want.receiver || info.Signature != want.signature {
+			t.Errorf("%s: receiver_type = %q, signature = %q; attendu %q, %q", name, info.ReceiverType, info.Signature, want.receiver, want.signature)
+		}
+	}
+}
+
+func TestIDDirHashTracesSameNamedFilesOfOnePackage(t *testing.T) {
+	// Deux handler.go du paquet handlers, dans deux dossiers: même base d'ID sans le hash.
+	root := writeTree(t, map[string]string{
+		"go.mod":                     "module example.com/svc\n\ngo 1.22\n",
+		"api/v1/handlers/handler.go": "package handlers\n\nfunc Serve() {}\n",
+		"api/v2/handlers/handler.go": "package handlers\n\nfunc Serve() {}\n",
+	})
+	opts := quietOptions()
+	opts.IDDirHash = true
+	manifest := parseTree(t, root, opts)
+	for _, dir := range []string{"api/v1/handlers", "api/v2/handlers"} {
+		id, _ := fragmentByName(t, manifest, dir+"/handler.go", "Serve")
+		if want := "handlers_handler" + dirHashSuffix(dir) + "_Serve"; id != want {
+			t.Errorf("ID de %s/handler.go = %s, attendu %s", dir, id, want)
+		}
+	}
+}
+
+func TestYAMLRoundTripMatchesJSON(t *testing.T) {
+	files := map[string]string{
+		"pkg/a/quoting.go": "package a\n\n// Tricky: \"guillemets\", deux-points: et #dièse.\n// true, 0123, null, - tiret\nconst Tricky = \"yes\"\n\nvar Empty = \"\"\n",
+	}
+	for rel, content := range sampleTree {
+		files[rel] = content
+	}
+	root := writeTree(t, files)
+	opts := quietOptions()
+	opts.EmitFileStats = true
+	opts.CommentDensity = true
+	var want FragmentManifest
+	if err := json.Unmarshal(runOutput(t, root, opts), &want); err != nil {
+		t.Fatal(err)
+	}
+	opts.Format = "yaml"
+	var decoded interface{}
+	if err := yaml.Unmarshal(runOutput(t, root, opts), &decoded); err != nil {
+		t.Fatalf("YAML illisible: %v", err)
+	}
+	// Le YAML relu repasse par JSON pour reprendre les tags de FragmentManifest.
+	data, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got FragmentManifest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		wantJSON, _ := json.MarshalIndent(want, "", "  ")
+		t.Fatalf("le YAML relu diffère du JSON:\n%s\n---\n%s", gotJSON, wantJSON)
+	}
+}
+
+func TestBlake2bDigest(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"go.mod":   "module example.com/digest\n\ngo 1.22\n",
+		"limit.go": "package digest\n\nvar Limit = 10\n",
+	})
+	opts := quietOptions()
+	opts.Digest = "blake2b"
+	manifest := parseTree(t, root, opts)
+	if manifest.DigestAlgorithm != "blake2b" {
+		t.Errorf("digest_algorithm = %q", manifest.DigestAlgorithm)
+	}
+	// Le code_digest d'une variable est celui de sa Definition.
+	_, limit := fragmentByName(t, manifest, "limit.go", "Limit")
+	sum := blake2b.Sum256([]byte(limit.Definition))
+	if want := hex.EncodeToString(sum[:]); limit.CodeDigest != want {
+		t.Errorf("code_digest = %s, attendu BLAKE2b-256 %s", limit.CodeDigest, want)
+	}
+
+	opts.Digest = "md5"
+	if _, err := ParseProject(root, opts); err == nil || !strings.Contains(err.Error(), "blake2b") {
+		t.Errorf("erreur pour -digest md5 = %v", err)
+	}
+}
+
+func TestSplitCallEdgesWithoutTypeCheck(t *testing.T) {
+	root := writeTree(t, sampleTree)
+	var logs bytes.Buffer
+	opts := quietOptions()
+	opts.Logger = log.New(&logs, "", 0)
+	opts.SplitCallEdges = true
+	manifest := parseTree(t, root, opts)
+	if strings.Contains(logs.String(), "Vérification de types") {
+		t.Errorf("-split-call-edges a lancé la vérification de types")
+	}
+	greetID, greet := fragmentByName(t, manifest, "pkg/a/a.go", "Greet")
+	normalizeID, _ := fragmentByName(t, manifest, "pkg/a/a.go", "normalize")
+	if !reflect.DeepEqual(greet.DirectCallsSamePackage, []string{normalizeID}) || greet.DirectCallsCrossPackage != nil {
+		t.Errorf("Greet: même paquet %v, autres paquets %v", greet.DirectCallsSamePackage, greet.DirectCallsCrossPackage)
+	}
+	_, twice := fragmentByName(t, manifest, "pkg/b/a.go", "Twice")
+	if !reflect.DeepEqual(twice.DirectCallsCrossPackage, []string{greetID}) || twice.DirectCallsSamePackage != nil {
+		t.Errorf("Twice: même paquet %v, autres paquets %v", twice.DirectCallsSamePackage, twice.DirectCallsCrossPackage)
+	}
+}
+
+func TestReadPackageName(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"short.go": "// Licence.\n\npackage court\n\nfunc F() {}\n",
+		"long.go":  "/*\n" + strings.Repeat("Licence très longue.\n", 1000) + "*/\n\npackage long\n",
+		"bad.go":   "pas du Go\n",
+	})
+	fset := token.NewFileSet()
+	for file, want := range map[string]string{"short.go": "court", "long.go": "long"} {
+		if got, err := readPackageName(diskSource(root), fset, filepath.Join(root, file)); err != nil || got != want {
+			t.Errorf("%s: %q, %v; attendu %q", file, got, err, want)
+		}
+	}
+	if _, err := readPackageName(diskSource(root), fset, filepath.Join(root, "bad.go")); err == nil {
+		t.Errorf("bad.go: pas d'erreur sans clause package")
+	}
+}
+
+func TestTypeParamsDoNotShadowPackageTypes(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/generic\n\ngo 1.22\n",
+		"generic.go": `package generic
+
+type T struct{}
+
+type U int
+
+func Map[T, U any](in []T, f func(T) U) []U { return nil }
+
+type G[T any] struct{ v T }
+
+func (g G[T]) Get() T { return g.v }
+
+func UsesT(t T) U { return 0 }
+`,
+	})
+	manifest := parseTree(t, root, quietOptions())
+	typeT, _ := fragmentByName(t, manifest, "generic.go", "T")
+	typeU, _ := fragmentByName(t, manifest, "generic.go", "U")
+	typeG, _ := fragmentByName(t, manifest, "generic.go", "G")
+	for name, want := range map[string][]string{
+		"Map":   nil,
+		"G":     nil,
+		"Get":   {typeG},
+		"UsesT": {typeT, typeU},
+	} {
+		_, info := fragmentByName(t, manifest, "generic.go", name)
+		if len(info.TypesUsedInternal) != len(want) || len(want) > 0 && !reflect.DeepEqual(info.TypesUsedInternal, want) {
+			t.Errorf("%s: types_used_internal = %v, attendu %v", name, info.TypesUsedInternal, want)
+		}
+	}
+}
+
+func TestCanonicalSignatureRenamesTypeParams(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/canon\n\ngo 1.22\n",
+		"canon.go": `package canon
+
+func Grouped[T, U any](x T, f func(T) U) U { return f(x) }
+
+func Split[A any, B any](a A, f func(A) B) B { return f(a) }
+
+func Index[S ~[]E, E comparable](s S, v E) int { return 0 }
+`,
+	})
+	opts := quietOptions()
+	opts.CanonicalSignatures = true
+	manifest := parseTree(t, root, opts)
+	for name, want := range map[string]string{
+		"Grouped": "func[T0 any, T1 any](T0, func(T0) T1) T1",
+		"Split":   "func[T0 any, T1 any](T0, func(T0) T1) T1",
+		"Index":   "func[T0 ~[]T1, T1 comparable](T0, T1) int",
+	} {
+		if _, info := fragmentByName(t, manifest, "canon.go", name); info.CanonicalSignature != want {
+			t.Errorf("%s: %q, attendu %q", name, info.CanonicalSignature, want)
+		}
+	}
+}
+
+func TestNameFilter(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/filter\n\ngo 1.22\n",
+		"server.go": `package filter
+
+type Server struct{}
+
+func (s *Server) Handler() {}
+
+func (s *Server) Start() {}
+
+func LoginHandler() {}
+
+func helper() {}
+`,
+	})
+	for _, tc := range []struct {
+		filter string
+		want   []string // Identifiers retenus, triés
+	}{
+		{"Handler$", []string{"Handler", "LoginHandler"}},
+		{"^Server$", []string{"Server"}}, // Le receveur ne fait pas retenir ses méthodes
+		{"^Start$", []string{"Start"}},   // Ni une méthode son receveur
+		{"^help", []string{"helper"}},
+		{"^Absent$", nil},
+	} {
+		opts := quietOptions()
+		opts.NameFilter = regexp.MustCompile(tc.filter)
+		var got []string
+		for _, info := range parseTree(t, root, opts).Fragments {
+			got = append(got, info.Identifier)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("-name-filter %q: %v, attendu %v", tc.filter, got, tc.want)
+		}
+	}
+}
+
+func TestDetectUntested(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"go.mod": "module example.com/untested\n\ngo 1.22\n",
+		"lib.go": `package lib
+
+func Tested() int { return helper() }
+
+func Untested() int { return 0 }
+
+func helper() int { return 1 }
+
+type Store struct{}
+
+func (s *Store) Get() int { return 0 }
+
+func (s *Store) Put(int) {}
+`,
+		"lib_test.go": `package lib
+
+import "testing"
+
+func TestTested(t *testing.T) {
+	t.Run("store", func(t *testing.T) {
+		var s Store
+		s.Get()
+	})
+	if Tested() != 1 {
+		t.Fatal("Tested")
+	}
+}
+`,
+	})
+	var logs bytes.Buffer
+	opts := quietOptions()
+	opts.DetectUntested = true
+	opts.Logger = log.New(&logs, "", 0)
+	manifest := parseTree(t, root, opts)
+	for _, tc := range []struct {
+		name     string
+		hasTest  bool
+		reported bool // Listé dans le résumé "Sans test" du journal
+	}{
+		{"Tested", true, false},
+		{"Get", true, false}, // Appel depuis une closure de t.Run
+		{"Untested", false, true},
+		{"Put", false, true},
+		{"helper", false, false}, // Non exporté: appelé indirectement, jamais signalé
+	} {
+		id, info := fragmentByName(t, manifest, "lib.go", tc.name)
+		if info.HasTest != tc.hasTest {
+			t.Errorf("%s: has_test = %v, attendu %v", tc.name, info.HasTest, tc.hasTest)
+		}
+		if reported := strings.Contains(logs.String(), "Sans test: "+id+" "); reported != tc.reported {
+			t.Errorf("%s: signalé sans test = %v, attendu %v\n%s", tc.name, reported, tc.reported, logs.String())
+		}
+	}
+	if !strings.Contains(logs.String(), "2 fonction(s)/méthode(s) exportée(s) sans test.") {
+		t.Errorf("résumé absent ou erroné:\n%s", logs.String())
+	}
+}
+
+// TestAnalyzerSteps exécute une à une les étapes d'analyze sur sampleTree: parcours, traitement
+// d'un fichier, fusion, passes sur le manifeste entier.
+func TestAnalyzerSteps(t *testing.T) {
+	root := writeTree(t, sampleTree)
+	opts := quietOptions()
+	if err := opts.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	a, err := newAnalyzer(root, nil, &opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Parcours seul: les fichiers sont mis en file dans l'ordre lexical, sans être lus.
+	a.jobs = make(chan *fileJob, 16)
+	a.pending = make(chan *fileJob, 16)
+	if err := a.walk(); err != nil {
+		t.Fatal(err)
+	}
+	close(a.jobs)
+	close(a.pending)
+	var queued []*fileJob
+	var relPaths []string
+	for job := range a.pending {
+		queued = append(queued, job)
+		relPaths = append(relPaths, job.relPath)
+	}
+	if want := []string{"cmd/app/main.go", "pkg/a/a.go", "pkg/a/b.go", "pkg/b/a.go"}; !reflect.DeepEqual(relPaths, want) {
+		t.Fatalf("fichiers en file %v, attendu %v", relPaths, want)
+	}
+
+	// Traitement: les fragments restent dans le résultat du fichier jusqu'à la fusion.
+	for _, job := range queued {
+		a.processFile(job)
+	}
+	if len(a.manifest.Fragments) != 0 {
+		t.Fatalf("processFile a écrit %d fragment(s) dans le manifeste", len(a.manifest.Fragments))
+	}
+	if _, ok := queued[1].result.fragments["a_a_Greet"]; !ok {
+		t.Fatalf("Greet absent du résultat de pkg/a/a.go: %v", queued[1].result.fragments)
+	}
+
+	// Fusion, puis passes: les appels ne sont résolus qu'après la fusion de tous les fichiers.
+	// La fusion suffixe les IDs du second a.go homonyme: aucun fragment n'est écrasé.
+	total := 0
+	for _, job := range queued {
+		total += len(job.result.fragments)
+		a.mergeFile(job)
+	}
+	if len(a.manifest.Fragments) != total {
+		t.Fatalf("%d fragment(s) fusionné(s), attendu %d", len(a.manifest.Fragments), total)
+	}
+	if calls := a.manifest.Fragments["a_a_Greet"].DirectCallsInternal; len(calls) != 0 {
+		t.Fatalf("appels résolus avant postPasses: %v", calls)
+	}
+	a.postPasses()
+	if calls := a.manifest.Fragments["a_a_Greet"].DirectCallsInternal; !reflect.DeepEqual(calls, []string{"a_a_normalize"}) {
+		t.Errorf("appels de Greet après postPasses: %v", calls)
+	}
+	if !reflect.DeepEqual(a.manifest.Entrypoints, []string{"main_main_main"}) {
+		t.Errorf("entrypoints: %v", a.manifest.Entrypoints)
+	}
+}
+
+// sourcesOf convertit une arborescence de test en sources pour ParseSources.
+func sourcesOf(files map[string]string) map[string][]byte {
+	sources := make(map[string][]byte, len(files))
+	for name, content := range files {
+		sources[name] = []byte(content)
+	}
+	return sources
+}
+
+func TestParseSourcesMatchesDisk(t *testing.T) {
+	for _, files := range []map[string]string{sampleTree, callsTree} {
+		want := parseTree(t, writeTree(t, files), quietOptions())
+		got, err := ParseSources(sourcesOf(files), quietOptions())
+		if err != nil {
+			t.Fatalf("ParseSources: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			gotJSON, _ := json.MarshalIndent(got, "", "  ")
+			wantJSON, _ := json.MarshalIndent(want, "", "  ")
+			t.Errorf("manifeste en mémoire différent du disque:\n%s\nattendu:\n%s", gotJSON, wantJSON)
+		}
+	}
+}
+
+func TestParseSourcesTemplAndRelativePaths(t *testing.T) {
+	opts := quietOptions()
+	opts.RespectGitignore = true
+	opts.MarkInternalImports = true
+	manifest, err := ParseSources(map[string][]byte{
+		"go.mod":                    []byte("module example.com/site\n\ngo 1.22\n"),
+		".gitignore":                []byte("tmp/\n"),
+		"./views/page.templ":        []byte("package views\n"),
+		"views/page_templ.go":       []byte("// Code generated by templ - DO NOT EDIT.\n\npackage views\n\nfunc Page() string { return \"page\" }\n"),
+		"templates/layout.templ":    []byte("package views\n"),
+		"views/gen/layout_templ.go": []byte("// Code generated by templ - DO NOT EDIT.\n// File: templates/layout.templ\n\npackage gen\n\nimport \"example.com/site/views\"\n\nfunc Layout() string { return views.Page() }\n"),
+		"tmp/scratch.go":            []byte("package tmp\n\nfunc Scratch() {}\n"),
+	}, opts)
+	if err != nil {
+		t.Fatalf("ParseSources: %v", err)
+	}
+	_, page := fragmentByName(t, manifest, "views/page_templ.go", "Page")
+	if !page.IsTemplSource || page.ActualSourcePath != "views/page.templ" {
+		t.Errorf("Page: source %q (templ: %v), attendu views/page.templ", page.ActualSourcePath, page.IsTemplSource)
+	}
+	_, layout := fragmentByName(t, manifest, "views/gen/layout_templ.go", "Layout")
+	if !layout.IsTemplSource || layout.ActualSourcePath != "templates/layout.templ" {
+		t.Errorf("Layout: source %q (templ: %v), attendu templates/layout.templ", layout.ActualSourcePath, layout.IsTemplSource)
+	}
+	if len(layout.Imports) != 1 || !layout.Imports[0].IsInternalToModule {
+		t.Errorf("Layout: imports %+v, attendu example.com/site/views interne au module du go.mod", layout.Imports)
+	}
+	for _, info := range manifest.Fragments {
+		if strings.HasPrefix(info.OriginalPath, "tmp/") {
+			t.Errorf("%s analysé malgré le .gitignore", info.OriginalPath)
+		}
+	}
+}
+
+func TestParseSourcesRejectsInvalidInput(t *testing.T) {
+	if _, err := ParseSources(map[string][]byte{"../a.go": []byte("package a\n")}, quietOptions()); err == nil {
+		t.Errorf("chemin hors racine accepté")
+	}
+	if _, err := ParseSources(map[string][]byte{"/abs/a.go": []byte("package a\n")}, quietOptions()); err == nil {
+		t.Errorf("chemin absolu accepté")
+	}
+	opts := quietOptions()
+	opts.TypeCheck = true
+	if _, err := ParseSources(sourcesOf(sampleTree), opts); err == nil {
+		t.Errorf("-type-check accepté sur des sources en mémoire")
+	}
+}
+
+// drainStream lit les deux canaux de ParseStream jusqu'à leur fermeture et retourne les
+// fragments reçus et l'erreur éventuelle; le test échoue si un canal reste ouvert.
+func drainStream(tb testing.TB, fragments <-chan FragmentInfo, errc <-chan error) ([]FragmentInfo, error) {
+	tb.Helper()
+	var got []FragmentInfo
+	timeout := time.After(30 * time.Second)
+	for fragments != nil {
+		select {
+		case info, ok := <-fragments:
+			if !ok {
+				fragments = nil
+				continue
+			}
+			got = append(got, info)
+		case <-timeout:
+			tb.Fatalf("canal des fragments non fermé après %d fragment(s)", len(got))
+		}
+	}
+	var err error
+	select {
+	case err = <-errc:
+	case <-timeout:
+		tb.Fatalf("canal d'erreur non fermé")
+	}
+	if extra, ok := <-errc; ok {
+		tb.Fatalf("seconde erreur %v: canal d'erreur non fermé", extra)
+	}
+	return got, err
+}
+
+func TestParseStreamMatchesNDJSON(t *testing.T) {
+	root := writeTree(t, syntheticTree(60))
+	opts := quietOptions()
+	opts.Jobs = 8
+	fragments, errc := ParseStream(context.Background(), root, opts)
+	got, err := drainStream(t, fragments, errc)
+	if err != nil {
+		t.Fatalf("ParseStream: %v", err)
+	}
+	opts.NDJSON = true
+	var want []FragmentInfo
+	for _, line := range strings.Split(strings.TrimSuffix(string(runOutput(t, root, opts)), "\n"), "\n") {
+		var entry FragmentEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, entry.FragmentInfo)
+	}
+	// Comparés en JSON: le passage par -ndjson perd la différence entre liste vide et nil.
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("%d fragment(s) reçus, différents des %d de -ndjson", len(got), len(want))
+	}
+}
+
+func TestParseStreamStopsOnCancel(t *testing.T) {
+	root := writeTree(t, syntheticTree(200))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fragments, errc := ParseStream(ctx, root, quietOptions())
+	if _, ok := <-fragments; !ok {
+		t.Fatal("canal fermé avant le premier fragment")
+	}
+	cancel()
+	got, err := drainStream(t, fragments, errc)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("erreur %v, attendu context.Canceled", err)
+	}
+	// Le parcours s'arrête: seuls les fichiers déjà en file peuvent encore livrer leurs fragments.
+	if total := 200*4 + 190; len(got)+1 >= total {
+		t.Errorf("%d fragment(s) reçus après l'annulation sur %d: le parcours ne s'est pas arrêté", len(got), total)
+	}
+
+	fragments, errc = ParseStream(ctx, root, quietOptions())
+	got, err = drainStream(t, fragments, errc)
+	if len(got) != 0 || !errors.Is(err, context.Canceled) {
+		t.Errorf("contexte déjà annulé: %d fragment(s), erreur %v", len(got), err)
+	}
+}
+
+func TestParseStreamRejectsWholeManifestOptions(t *testing.T) {
+	opts := quietOptions()
+	opts.SplitCallEdges = true
+	fragments, errc := ParseStream(context.Background(), writeTree(t, sampleTree), opts)
+	got, err := drainStream(t, fragments, errc)
+	if len(got) != 0 || err == nil || !strings.Contains(err.Error(), "-split-call-edges") {
+		t.Errorf("-split-call-edges: %d fragment(s), erreur %v", len(got), err)
+	}
+}
@@ -0,0 +1,16 @@
+module github.com/remi-viau/Code-Expert/code/manifest/bin
+
+go 1.22.0
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require (
+	golang.org/x/mod v0.22.0 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+	golang.org/x/tools v0.29.0
+)
+
+require (
+	golang.org/x/crypto v0.31.0
+	golang.org/x/sys v0.29.0 // indirect
+)